@@ -1,12 +1,13 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
-	"strconv"
 	"sync"
 	"syscall"
+	"time"
 
 	"nk2-PLCcapture-go/pkg/config"
 	"nk2-PLCcapture-go/pkg/mqtt"
@@ -23,6 +24,7 @@ func main() {
 	mqttHost := os.Getenv("MQTT_HOST")
 	plcHost := os.Getenv("PLC_HOST")
 	plcPort := config.GetEnvAsInt("PLC_PORT", 5011)
+	plcTimeout := time.Duration(config.GetEnvAsInt("PLC_TIMEOUT_MS", 5000)) * time.Millisecond
 	devices16 := os.Getenv("DEVICES_16bit")
 	devices32 := os.Getenv("DEVICES_32bit")
 
@@ -30,6 +32,10 @@ func main() {
 	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
 
+	// ctx is canceled on SIGINT or SIGTERM, in-flight PLC I/O is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	// Create a logger to use for logging messages
 	logger := log.New(os.Stdout, "", log.LstdFlags)
 
@@ -65,6 +71,7 @@ func main() {
 			// If a SIGINT or SIGTERM signal is received, set the shutdown variable to true
 			if sig == syscall.SIGINT || sig == syscall.SIGTERM {
 				shutdown = true
+				cancel()
 				break
 			}
 		}
@@ -111,13 +118,16 @@ func main() {
 				go func(device utils.Device) {
 					defer wg.Done()
 					for {
-						value, err := plc.ReadData(device.DeviceType, device.DeviceNumber, device.NumberRegisters)
+						// each read is limited by PLC_TIMEOUT_MS, so a PLC which does not respond does not stall the scan
+						readCtx, readCancel := context.WithTimeout(ctx, plcTimeout)
+						value, err := plc.ReadDataContext(readCtx, device.DeviceType, device.DeviceNumber, device.NumberRegisters)
+						readCancel()
 						if err != nil {
-							logger.Printf("Error reading data from PLC for device %s: %s", device.DeviceType+strconv.Itoa(int(device.DeviceNumber)), err)
+							logger.Printf("Error reading data from PLC for device %s: %s", device.Address(), err)
 							break
 						}
 						message := map[string]interface{}{
-							"address": device.DeviceType + strconv.Itoa(int(device.DeviceNumber)),
+							"address": device.Address(),
 							"value":   value,
 						}
 						dataCh <- message
@@ -142,6 +152,7 @@ func main() {
 	case <-signalCh:
 		logger.Println("Program terminated by signal")
 		shutdown = true
+		cancel()
 	}
 
 	// Disconnect from the MQTT server
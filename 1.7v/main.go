@@ -6,7 +6,6 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
-	"strconv"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -31,6 +30,7 @@ func main() {
 	mqttHost := os.Getenv("MQTT_HOST")
 	plcHost := os.Getenv("PLC_HOST")
 	plcPort := config.GetEnvAsInt("PLC_PORT", 5011)
+	plcTimeout := time.Duration(config.GetEnvAsInt("PLC_TIMEOUT_MS", 5000)) * time.Millisecond
 	devices16 := os.Getenv("DEVICES_16bit")
 	devices32 := os.Getenv("DEVICES_32bit")
 
@@ -84,7 +84,7 @@ func main() {
 
 	go startWorkers(ctx, workerCount, dataCh, mqttclient, logger, &wg)
 
-	go readDataFromDevices(ctx, devices, dataCh, &wg, logger)
+	go readDataFromDevices(ctx, plcTimeout, devices, dataCh, &wg, logger)
 
 	select {
 	case <-signalCh:
@@ -130,7 +130,7 @@ func startWorkers(ctx context.Context, workerCount int, dataCh <-chan map[string
 	wg.Wait()
 }
 
-func readDataFromDevices(ctx context.Context, devices []utils.Device, dataCh chan<- map[string]interface{}, wg *sync.WaitGroup, logger *log.Logger) {
+func readDataFromDevices(ctx context.Context, plcTimeout time.Duration, devices []utils.Device, dataCh chan<- map[string]interface{}, wg *sync.WaitGroup, logger *log.Logger) {
 	devicesReadCount = 0
 
 	for _, device := range devices {
@@ -139,15 +139,18 @@ func readDataFromDevices(ctx context.Context, devices []utils.Device, dataCh cha
 			defer wg.Done()
 
 			for {
-				value, err := plc.ReadData(device.DeviceType, device.DeviceNumber, device.NumberRegisters)
+				// each read is limited by PLC_TIMEOUT_MS, so a PLC which does not respond does not stall the scan
+				readCtx, readCancel := context.WithTimeout(ctx, plcTimeout)
+				value, err := plc.ReadDataContext(readCtx, device.DeviceType, device.DeviceNumber, device.NumberRegisters)
+				readCancel()
 				if err != nil {
-					logger.Printf("Error reading data from PLC for device %s: %s", device.DeviceType+strconv.Itoa(int(device.DeviceNumber)), err)
+					logger.Printf("Error reading data from PLC for device %s: %s", device.Address(), err)
 					time.Sleep(1 * time.Second)
 					continue
 				}
 
 				message := make(map[string]interface{})
-				message["address"] = device.DeviceType + strconv.Itoa(int(device.DeviceNumber))
+				message["address"] = device.Address()
 				message["value"] = value
 
 				select {
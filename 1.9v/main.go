@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"nk2-PLCcapture-go/pkg/config"
+	"nk2-PLCcapture-go/pkg/mcp"
 	"nk2-PLCcapture-go/pkg/mqtt"
 	"nk2-PLCcapture-go/pkg/plc"
 	"nk2-PLCcapture-go/pkg/utils"
@@ -22,6 +27,17 @@ func main() {
 	mqttHost := os.Getenv("MQTT_HOST")
 	plcHost := os.Getenv("PLC_HOST")
 	plcPort := config.GetEnvAsInt("PLC_PORT", 5011)
+	plcPorts := os.Getenv("PLC_PORTS")
+	plcConnsPerPort := config.GetEnvAsInt("PLC_CONNS_PER_PORT", 1)
+	plcFrame := os.Getenv("PLC_FRAME")
+	plcSeries := os.Getenv("PLC_SERIES")
+	pollMode := os.Getenv("PLC_POLL_MODE")
+	plcPassword := os.Getenv("PLC_PASSWORD")
+	plcRoute := os.Getenv("PLC_ROUTE")
+	plcTransport := os.Getenv("PLC_TRANSPORT")
+	reconnectMin := config.GetEnvAsInt("PLC_RECONNECT_MIN_MS", 0)
+	reconnectMax := config.GetEnvAsInt("PLC_RECONNECT_MAX_MS", 0)
+	plcTimeout := time.Duration(config.GetEnvAsInt("PLC_TIMEOUT_MS", 5000)) * time.Millisecond
 	devices16 := os.Getenv("DEVICES_16bit")
 	devices32 := os.Getenv("DEVICES_32bit")
 	devices2 := os.Getenv("DEVICES_2bit")
@@ -31,6 +47,10 @@ func main() {
 	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
 
+	// ctx is canceled on SIGINT or SIGTERM, in-flight PLC I/O is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	// Create a logger to use for logging messages
 	logger := log.New(os.Stdout, "", log.LstdFlags)
 
@@ -72,19 +92,102 @@ func main() {
 			// If a SIGINT or SIGTERM signal is received, set the shutdown variable to true
 			if sig == syscall.SIGINT || sig == syscall.SIGTERM {
 				shutdown = true
+				cancel()
 				break
 			}
 		}
 	}()
 
+	// Parse the open connection ports of the connection pool like "5011,5012"
+	var ports []int
+	if plcPorts != "" {
+		for _, p := range strings.Split(plcPorts, ",") {
+			port, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil {
+				logger.Fatalf("Error parsing PLC_PORTS: %v", err)
+			}
+			ports = append(ports, port)
+		}
+	}
+
+	// Publish the PLC connection state (connecting/up/down) to the status topic.
+	// the state handler must not block the PLC I/O, so the states are published by the goroutine.
+	statusCh := make(chan map[string]interface{}, 16)
+	go func() {
+		for status := range statusCh {
+			statusJSON, err := jsoniter.Marshal(status)
+			if err != nil {
+				logger.Printf("Error marshaling status to JSON: %s", err)
+				continue
+			}
+			mqtt.PublishMessage(mqttclient, mqttTopic+"status", string(statusJSON), logger)
+		}
+	}()
+	stateHandler := func(state mcp.ConnState, err error) {
+		status := map[string]interface{}{
+			"state": state.String(),
+			"time":  time.Now().Format(time.RFC3339),
+		}
+		if err != nil {
+			status["error"] = err.Error()
+		}
+		select {
+		case statusCh <- status:
+		default:
+			logger.Printf("Status channel is full, PLC connection state %s is not published", state)
+		}
+	}
+
 	// Initialize the MSP client
-	err = plc.InitMSPClient(plcHost, plcPort)
+	err = plc.InitMSPClientWithConfig(plc.Config{
+		Host:         plcHost,
+		Port:         plcPort,
+		Ports:        ports,
+		ConnsPerPort: plcConnsPerPort,
+		Frame:        plcFrame,
+		Transport:    plcTransport,
+		Series:       plcSeries,
+		Password:     plcPassword,
+		Route:        plcRoute,
+		ReconnectMin: time.Duration(reconnectMin) * time.Millisecond,
+		ReconnectMax: time.Duration(reconnectMax) * time.Millisecond,
+		StateHandler: stateHandler,
+		Timeout:      plcTimeout,
+	})
 	if err != nil {
 		logger.Fatalf("Failed to initialize MSP client: %v", err)
 	} else {
 		logger.Printf("Start collecting data from %s", plcHost)
 	}
 
+	// Log the CPU model and publish it, so a wrong PLC_HOST can be noticed
+	modelCtx, modelCancel := context.WithTimeout(ctx, plcTimeout)
+	model, err := plc.ReadCPUModelContext(modelCtx)
+	modelCancel()
+	if err != nil {
+		logger.Printf("Error reading CPU model from PLC: %s", err)
+	} else {
+		logger.Printf("PLC CPU model is %s", model)
+		modelJSON, err := jsoniter.Marshal(map[string]interface{}{
+			"name": model.Name,
+			"code": fmt.Sprintf("%04X", model.Code),
+		})
+		if err == nil {
+			mqtt.PublishMessage(mqttclient, mqttTopic+"cpu_model", string(modelJSON), logger)
+		}
+	}
+
+	// In monitor poll mode, the devices are registered once and each scan sends only a small monitor command
+	var monitor *plc.Monitor
+	if pollMode == "monitor" {
+		monitorCtx, monitorCancel := context.WithTimeout(ctx, plcTimeout)
+		monitor, err = plc.NewMonitorContext(monitorCtx, devices)
+		monitorCancel()
+		if err != nil {
+			logger.Fatalf("Failed to register monitor devices: %v", err)
+		}
+	}
+
 	// Use a goroutine to run the main loop
 	// Create an unbuffered channel to store the data to be processed
 	dataCh := make(chan map[string]interface{})
@@ -105,8 +208,11 @@ func main() {
 					continue
 				}
 
-				// Publish the message to the MQTT server
+				// Publish the message to the MQTT server. the device of the other station is under its access route
 				topic := mqttTopic + message["address"].(string)
+				if route, ok := message["route"].(string); ok {
+					topic = mqttTopic + route + "/" + message["address"].(string)
+				}
 				mqtt.PublishMessage(mqttclient, topic, string(messageJSON), logger)
 			}
 		}()
@@ -117,17 +223,29 @@ func main() {
 		defer close(dataCh) // Close the dataCh channel to signal workers to complete
 
 		for {
-			// Read data from devices and send it to dataCh
-			for _, device := range devices {
-				value, err := plc.ReadData(device.DeviceType, device.DeviceNumber, device.NumberRegisters)
-				if err != nil {
-					logger.Printf("Error reading data from PLC for device %s: %s", device.DeviceType+strconv.Itoa(int(device.DeviceNumber)), err)
-					break
-				}
+			// Read data from all devices with random read (or monitor) and send it to dataCh.
+			// each scan is limited by PLC_TIMEOUT_MS, so a PLC which does not respond does not stall the loop
+			scanCtx, scanCancel := context.WithTimeout(ctx, plcTimeout)
+			var values []interface{}
+			var err error
+			if monitor != nil {
+				values, err = monitor.ReadDataContext(scanCtx)
+			} else {
+				values, err = plc.ReadDataRandomContext(scanCtx, devices)
+			}
+			scanCancel()
+			if err != nil {
+				logger.Printf("Error reading data from PLC: %s", err)
+			}
+			for i, value := range values {
+				device := devices[i]
 				message := map[string]interface{}{
-					"address": device.DeviceType + strconv.Itoa(int(device.DeviceNumber)),
+					"address": device.Address(),
 					"value":   value,
 				}
+				if device.Route != "" {
+					message["route"] = device.Route
+				}
 				dataCh <- message
 			}
 
@@ -150,6 +268,7 @@ func main() {
 	case <-signalCh:
 		logger.Println("Program terminated by signal")
 		shutdown = true
+		cancel()
 	}
 
 	// Perform any necessary cleanup tasks and exit the program
@@ -1,20 +1,102 @@
 package mcp
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// request destination module I/O number of the route.
+	ModuleIOOwnCPU   uint16 = 0x03FF // 自局CPU
+	ModuleIOMultiCPU uint16 = 0x03E0 // マルチCPU 1号機. 2号機 to 4号機 are 03E1 to 03E3.
+	ModuleIOControl  uint16 = 0x03D0 // 二重化システム 制御系CPU
+	ModuleIOStandby  uint16 = 0x03D1 // 二重化システム 待機系CPU
+)
+
+// AccessRoute is the access route of the request from the connected ethernet module to the target station
+// on MELSECNET/H, MELSECNET/10 and CC-Link IE, and to the multidrop station.
 type AccessRoute struct {
-	Sts  station
-	Code Code
+	// network number of the target station. 0 is the own network.
+	NetworkNum uint8
+	// station number (PC number) of the target station. FFh is the connected station.
+	StationNum uint8
+	// request destination module I/O number. 03FFh is the CPU of the target station,
+	// start I/O number / 16 of the multidrop module (e.g. 0002h for the module of 0020) for multidrop connection.
+	ModuleIO uint16
+	// station number of the multidrop connection. 0 is not multidrop connection.
+	MultidropStation uint8
+}
+
+// LocalRoute is the route of the CPU of the connected station.
+var LocalRoute = AccessRoute{NetworkNum: 0x00, StationNum: 0xFF, ModuleIO: ModuleIOOwnCPU, MultidropStation: 0x00}
+
+// BinaryRoute returns the route of the binary code request.
+func (r AccessRoute) BinaryRoute() []byte {
+	return r.appendPath(nil, Binary)
 }
 
-func (r *AccessRoute) BinaryRoute() []byte {
+// AsciiRoute returns the route of the ascii code request.
+func (r AccessRoute) AsciiRoute() []byte {
+	return r.appendPath(nil, Ascii)
+}
 
-	return nil
+// Len returns byte size of the binary code route. ascii code route is twice the size.
+func (r AccessRoute) Len() int64 {
+	return 5
 }
 
-func (r *AccessRoute) AsciiRoute() []byte {
+// String returns the route in the syntax of ParseAccessRoute.
+func (r AccessRoute) String() string {
+	return fmt.Sprintf("%d:%d:%04X:%d", r.NetworkNum, r.StationNum, r.ModuleIO, r.MultidropStation)
+}
 
-	return nil
+// appendPath appends network number, PC number, request destination module I/O number
+// and request destination module station number of the code expression to dst.
+func (r AccessRoute) appendPath(dst []byte, code Code) []byte {
+	dst = code.appendUint(dst, int64(r.NetworkNum), 1)
+	dst = code.appendUint(dst, int64(r.StationNum), 1)
+	dst = code.appendUint(dst, int64(r.ModuleIO), 2)
+	return code.appendUint(dst, int64(r.MultidropStation), 1)
 }
 
-func (r *AccessRoute) Len() int64 {
-	return 0
+// ParseAccessRoute parses the route like "1:2" (network 1 station 2) or "0:255:0002:3"
+// (multidrop station 3 of the module of 0020 on the connected station).
+// syntax is network:station[:moduleIO[:multidrop]]. network, station and multidrop are decimal,
+// moduleIO is hex and 03FF by default. empty string is LocalRoute.
+func ParseAccessRoute(s string) (AccessRoute, error) {
+	if s == "" {
+		return LocalRoute, nil
+	}
+	fields := strings.Split(s, ":")
+	if len(fields) < 2 || len(fields) > 4 {
+		return AccessRoute{}, fmt.Errorf("invalid access route %q: must be network:station[:moduleIO[:multidrop]]", s)
+	}
+
+	route := LocalRoute
+	network, err := strconv.ParseUint(fields[0], 10, 8)
+	if err != nil {
+		return AccessRoute{}, fmt.Errorf("invalid network number of access route %q: %w", s, err)
+	}
+	route.NetworkNum = uint8(network)
+	stationNum, err := strconv.ParseUint(fields[1], 10, 8)
+	if err != nil {
+		return AccessRoute{}, fmt.Errorf("invalid station number of access route %q: %w", s, err)
+	}
+	route.StationNum = uint8(stationNum)
+	if len(fields) > 2 {
+		moduleIO, err := strconv.ParseUint(fields[2], 16, 16)
+		if err != nil {
+			return AccessRoute{}, fmt.Errorf("invalid module I/O number of access route %q: %w", s, err)
+		}
+		route.ModuleIO = uint16(moduleIO)
+	}
+	if len(fields) > 3 {
+		multidrop, err := strconv.ParseUint(fields[3], 10, 8)
+		if err != nil {
+			return AccessRoute{}, fmt.Errorf("invalid multidrop station number of access route %q: %w", s, err)
+		}
+		route.MultidropStation = uint8(multidrop)
+	}
+	return route, nil
 }
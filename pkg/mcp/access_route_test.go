@@ -0,0 +1,86 @@
+package mcp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseAccessRoute(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected AccessRoute
+	}{
+		{input: "", expected: LocalRoute},
+		{input: "1:2", expected: AccessRoute{NetworkNum: 1, StationNum: 2, ModuleIO: 0x03FF}},
+		{input: "0:255:0002:3", expected: AccessRoute{NetworkNum: 0, StationNum: 0xFF, ModuleIO: 0x0002, MultidropStation: 3}},
+		{input: "2:1:03E1", expected: AccessRoute{NetworkNum: 2, StationNum: 1, ModuleIO: ModuleIOMultiCPU + 1}},
+	}
+	for _, v := range cases {
+		actual, err := ParseAccessRoute(v.input)
+		if err != nil {
+			t.Fatalf("unexpected err of %q: %v", v.input, err)
+		}
+		if actual != v.expected {
+			t.Errorf("expected %v but actual is %v", v.expected, actual)
+		}
+	}
+
+	for _, input := range []string{"1", "1:2:3:4:5", "256:1", "1:2:XYZ"} {
+		if _, err := ParseAccessRoute(input); err == nil {
+			t.Errorf("expected err of %q but actual is nil", input)
+		}
+	}
+}
+
+func TestAccessRoute_Route(t *testing.T) {
+	route := AccessRoute{NetworkNum: 1, StationNum: 2, ModuleIO: ModuleIOOwnCPU}
+
+	if expected := []byte{0x01, 0x02, 0xFF, 0x03, 0x00}; !bytes.Equal(route.BinaryRoute(), expected) {
+		t.Errorf("expected %X but actual is %X", expected, route.BinaryRoute())
+	}
+	if expected := "010203FF00"; string(route.AsciiRoute()) != expected {
+		t.Errorf("expected %v but actual is %v", expected, string(route.AsciiRoute()))
+	}
+	if expected := int64(len(route.BinaryRoute())); route.Len() != expected {
+		t.Errorf("expected %v but actual is %v", expected, route.Len())
+	}
+
+	stn := NewLocalStation().SetRoute(route)
+	if actual := stn.BuildAccessPath(Binary); actual != "0102FF0300" {
+		t.Errorf("expected %v but actual is %v", "0102FF0300", actual)
+	}
+	if actual := stn.BuildAccessPath(Ascii); actual != string(route.AsciiRoute()) {
+		t.Errorf("expected %v but actual is %v", string(route.AsciiRoute()), actual)
+	}
+	if actual := NewLocalStation().SetRoute(LocalRoute).BuildAccessPath(Binary); actual != "00FFFF0300" {
+		t.Errorf("expected %v but actual is %v", "00FFFF0300", actual)
+	}
+}
+
+func TestClient3E_Route(t *testing.T) {
+	host, port := servePLC(t,
+		"d000 01 02 ff03 00 0400 0000 0100", // read of network 1 station 2
+	)
+
+	client, err := New3EClient(host, port, NewLocalStation())
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	routed, err := client.Route(AccessRoute{NetworkNum: 1, StationNum: 2, ModuleIO: ModuleIOOwnCPU})
+	if err != nil {
+		t.Fatalf("unexpected route err: %v", err)
+	}
+	resp, err := routed.Read("D", 100, 1)
+	if err != nil {
+		t.Fatalf("unexpected read err: %v", err)
+	}
+	response, err := NewParser().Do(resp)
+	if err != nil {
+		t.Fatalf("unexpected parse err: %v", err)
+	}
+	if response.NetworkNum != "01" || response.PCNum != "02" {
+		t.Fatalf("unexpected response route: %+v", response)
+	}
+}
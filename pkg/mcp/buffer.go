@@ -0,0 +1,104 @@
+package mcp
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+)
+
+// ReadMemory is send memory read command to remote plc.
+// it reads the buffer memory of the own station ethernet module. address and numPoints are word units.
+// numPoints is 1 to 480 points.
+func (c *baseClient) ReadMemory(address, numPoints int64) ([]uint16, error) {
+	return c.ReadMemoryContext(context.Background(), address, numPoints)
+}
+
+// ReadMemoryContext is ReadMemory with the context. the request is canceled when ctx is done.
+func (c *baseClient) ReadMemoryContext(ctx context.Context, address, numPoints int64) ([]uint16, error) {
+	if numPoints < 1 || numPoints > 480 {
+		return nil, fmt.Errorf("memory read points must be 1 to 480 but %v", numPoints)
+	}
+	command := c.stn.appendMemoryCommand(nil, c.code, MEMORY_READ_COMMAND, address, numPoints, nil)
+	return c.readBuffer(ctx, command, numPoints)
+}
+
+// WriteMemory is send memory write command to remote plc.
+// values are written to the buffer memory of the own station ethernet module from the word address.
+// number of values is 1 to 480 points.
+func (c *baseClient) WriteMemory(address int64, values []uint16) error {
+	return c.WriteMemoryContext(context.Background(), address, values)
+}
+
+// WriteMemoryContext is WriteMemory with the context. the request is canceled when ctx is done.
+func (c *baseClient) WriteMemoryContext(ctx context.Context, address int64, values []uint16) error {
+	if len(values) < 1 || len(values) > 480 {
+		return fmt.Errorf("memory write points must be 1 to 480 but %v", len(values))
+	}
+	command := c.stn.appendMemoryCommand(nil, c.code, MEMORY_WRITE_COMMAND, address, int64(len(values)), wordBytes(values))
+	_, err := c.request(ctx, command, 0, c.code.decodeWords)
+	return err
+}
+
+// ReadModuleBuffer is send intelligent function module buffer memory read command to remote plc.
+// startIO is the module start I/O number (e.g. 0x0020 for the module of X/Y20, "U2\G" notation).
+// address is buffer memory word address and numPoints is 1 to 960 points.
+func (c *baseClient) ReadModuleBuffer(startIO uint16, address, numPoints int64) ([]uint16, error) {
+	return c.ReadModuleBufferContext(context.Background(), startIO, address, numPoints)
+}
+
+// ReadModuleBufferContext is ReadModuleBuffer with the context. the request is canceled when ctx is done.
+func (c *baseClient) ReadModuleBufferContext(ctx context.Context, startIO uint16, address, numPoints int64) ([]uint16, error) {
+	if numPoints < 1 || numPoints > 960 {
+		return nil, fmt.Errorf("module buffer read points must be 1 to 960 but %v", numPoints)
+	}
+	// buffer memory is addressed in byte units
+	command := c.stn.appendModuleBufferCommand(nil, c.code, MODULE_BUFFER_READ_COMMAND, startIO>>4, 2*address, 2*numPoints, nil)
+	return c.readBuffer(ctx, command, numPoints)
+}
+
+// WriteModuleBuffer is send intelligent function module buffer memory write command to remote plc.
+// values are written from the buffer memory word address of the module at startIO.
+// number of values is 1 to 960 points.
+func (c *baseClient) WriteModuleBuffer(startIO uint16, address int64, values []uint16) error {
+	return c.WriteModuleBufferContext(context.Background(), startIO, address, values)
+}
+
+// WriteModuleBufferContext is WriteModuleBuffer with the context. the request is canceled when ctx is done.
+func (c *baseClient) WriteModuleBufferContext(ctx context.Context, startIO uint16, address int64, values []uint16) error {
+	if len(values) < 1 || len(values) > 960 {
+		return fmt.Errorf("module buffer write points must be 1 to 960 but %v", len(values))
+	}
+	command := c.stn.appendModuleBufferCommand(nil, c.code, MODULE_BUFFER_WRITE_COMMAND, startIO>>4, 2*address, 2*int64(len(values)), wordBytes(values))
+	_, err := c.request(ctx, command, 0, c.code.decodeWords)
+	return err
+}
+
+// readBuffer sends memory read command and returns numPoints words of the response.
+func (c *baseClient) readBuffer(ctx context.Context, command []byte, numPoints int64) ([]uint16, error) {
+	resp, err := c.request(ctx, command, c.code.fieldSize(2)*numPoints, c.code.decodeWords)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := NewParser().Payload(resp)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(payload)) != 2*numPoints {
+		return nil, fmt.Errorf("memory read data length must be %v but %v", 2*numPoints, len(payload))
+	}
+	values := make([]uint16, numPoints)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint16(payload[2*i:])
+	}
+	return values, nil
+}
+
+// wordBytes converts words to little endian bytes.
+func wordBytes(values []uint16) []byte {
+	data := make([]byte, 2*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint16(data[2*i:], v)
+	}
+	return data
+}
@@ -0,0 +1,77 @@
+package mcp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStation_BuildMemoryCommand(t *testing.T) {
+	station := NewLocalStation()
+
+	cases := []struct {
+		actual   string
+		expected string
+	}{
+		{
+			actual:   Binary.string(station.appendMemoryCommand(nil, Binary, MEMORY_READ_COMMAND, 0x78, 2, nil)),
+			expected: "01060000" + "78000000" + "0200",
+		},
+		{
+			actual:   Ascii.string(station.appendMemoryCommand(nil, Ascii, MEMORY_WRITE_COMMAND, 0x78, 1, []byte{0x34, 0x12})),
+			expected: "16010000" + "00000078" + "0001" + "1234",
+		},
+		{
+			// buffer memory 100(64h) of the module at start I/O 0020
+			actual:   Binary.string(station.appendModuleBufferCommand(nil, Binary, MODULE_BUFFER_READ_COMMAND, 0x02, 0xC8, 4, nil)),
+			expected: "13060000" + "C8000000" + "0400" + "0200",
+		},
+		{
+			actual:   Ascii.string(station.appendModuleBufferCommand(nil, Ascii, MODULE_BUFFER_READ_COMMAND, 0x02, 0xC8, 4, nil)),
+			expected: "06130000" + "000000C8" + "0004" + "0002",
+		},
+	}
+
+	for _, v := range cases {
+		if v.actual != v.expected {
+			t.Errorf("expected %v but actual is %v", v.expected, v.actual)
+		}
+	}
+}
+
+func TestClient3E_ModuleBuffer(t *testing.T) {
+	host, port := servePLC(t,
+		"d000 00 ff ff03 00 0600 0000 3412 7856", // module buffer read
+		"d000 00 ff ff03 00 0200 0000",           // module buffer write
+		"d000 00 ff ff03 00 0400 0000 0100",      // memory read
+	)
+
+	client, err := New3EClient(host, port, NewLocalStation())
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	values, err := client.ReadModuleBuffer(0x0020, 100, 2)
+	if err != nil {
+		t.Fatalf("unexpected module buffer read err: %v", err)
+	}
+	if expected := []uint16{0x1234, 0x5678}; !reflect.DeepEqual(values, expected) {
+		t.Fatalf("expected %v but actual is %v", expected, values)
+	}
+
+	if err := client.WriteModuleBuffer(0x0020, 100, []uint16{1}); err != nil {
+		t.Fatalf("unexpected module buffer write err: %v", err)
+	}
+
+	values, err = client.ReadMemory(0x78, 1)
+	if err != nil {
+		t.Fatalf("unexpected memory read err: %v", err)
+	}
+	if expected := []uint16{1}; !reflect.DeepEqual(values, expected) {
+		t.Fatalf("expected %v but actual is %v", expected, values)
+	}
+
+	if _, err := client.ReadModuleBuffer(0x0020, 100, 961); err == nil {
+		t.Fatalf("expected points limit error but actual is nil")
+	}
+}
@@ -1,93 +1,819 @@
 package mcp
 
 import (
-	"encoding/hex"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"sync"
+	"time"
 )
 
 type Client interface {
 	Read(deviceName string, offset, numPoints int64) ([]byte, error)
+	BitRead(deviceName string, offset, numPoints int64) ([]byte, error)
+	Write(deviceName string, offset, numPoints int64, writeData []byte) ([]byte, error)
+	ReadRandom(words, dwords []DeviceAddr) (map[DeviceAddr]uint16, map[DeviceAddr]uint32, error)
+	WriteRandomWords(words map[DeviceAddr]uint16, dwords map[DeviceAddr]uint32) error
+	WriteRandomBits(bits map[DeviceAddr]bool) error
+	ReadBlocks(words, bits []Block) ([][]uint16, [][]uint16, error)
+	WriteBlocks(words, bits []Block) error
+	RegisterMonitor(words, dwords []DeviceAddr) (*Monitor, error)
+	ReadCPUModel() (CPUModel, error)
+	ReadMemory(address, numPoints int64) ([]uint16, error)
+	WriteMemory(address int64, values []uint16) error
+	ReadModuleBuffer(startIO uint16, address, numPoints int64) ([]uint16, error)
+	WriteModuleBuffer(startIO uint16, address int64, values []uint16) error
+	Route(route AccessRoute) (Client, error)
+	Unlock(password string) error
+	Lock(password string) error
+	RemoteRun(force bool, clear ClearMode, confirm Confirm) error
+	RemoteStop(confirm Confirm) error
+	RemotePause(force bool, confirm Confirm) error
+	RemoteLatchClear(confirm Confirm) error
+	RemoteReset(confirm Confirm) error
+	HealthCheck() error
+	ReadContext(ctx context.Context, deviceName string, offset, numPoints int64) ([]byte, error)
+	BitReadContext(ctx context.Context, deviceName string, offset, numPoints int64) ([]byte, error)
+	WriteContext(ctx context.Context, deviceName string, offset, numPoints int64, writeData []byte) ([]byte, error)
+	ReadRandomContext(ctx context.Context, words, dwords []DeviceAddr) (map[DeviceAddr]uint16, map[DeviceAddr]uint32, error)
+	WriteRandomWordsContext(ctx context.Context, words map[DeviceAddr]uint16, dwords map[DeviceAddr]uint32) error
+	WriteRandomBitsContext(ctx context.Context, bits map[DeviceAddr]bool) error
+	ReadBlocksContext(ctx context.Context, words, bits []Block) ([][]uint16, [][]uint16, error)
+	WriteBlocksContext(ctx context.Context, words, bits []Block) error
+	RegisterMonitorContext(ctx context.Context, words, dwords []DeviceAddr) (*Monitor, error)
+	ReadCPUModelContext(ctx context.Context) (CPUModel, error)
+	ReadMemoryContext(ctx context.Context, address, numPoints int64) ([]uint16, error)
+	WriteMemoryContext(ctx context.Context, address int64, values []uint16) error
+	ReadModuleBufferContext(ctx context.Context, startIO uint16, address, numPoints int64) ([]uint16, error)
+	WriteModuleBufferContext(ctx context.Context, startIO uint16, address int64, values []uint16) error
+	UnlockContext(ctx context.Context, password string) error
+	LockContext(ctx context.Context, password string) error
+	RemoteRunContext(ctx context.Context, force bool, clear ClearMode, confirm Confirm) error
+	RemoteStopContext(ctx context.Context, confirm Confirm) error
+	RemotePauseContext(ctx context.Context, force bool, confirm Confirm) error
+	RemoteLatchClearContext(ctx context.Context, confirm Confirm) error
+	RemoteResetContext(ctx context.Context, confirm Confirm) error
+	HealthCheckContext(ctx context.Context) error
 	Close() error
 }
 
+// ErrUnsupported is returned when the command is not supported by the frame.
+var ErrUnsupported = errors.New("command is not supported by the frame")
+
+// transport sends the command wrapped in its frame and returns the response frame.
+// command is the bytes on the wire of the code, it is not used after roundTrip returns.
+// respSize is the size of 3E response frame of normal end in the code, 4E frame is larger by the serial number.
+// the frame is addressed to stn. the round trip is canceled when ctx is done.
+type transport interface {
+	roundTrip(ctx context.Context, stn *station, command []byte, respSize int64) ([]byte, error)
+}
+
+// multiConnTransport is the transport which spreads the requests over several connections like Pool.
+// the plc keeps the monitor registration and the remote password unlock per connection,
+// so these requests are sent on the specific connection.
+type multiConnTransport interface {
+	transport
+	// pinConn returns the transport of one connection, e.g. for the monitor.
+	pinConn() transport
+	// eachConn returns the transports of all the connections.
+	eachConn() []transport
+}
+
+// buffers are reusable buffers of the command and the response header.
+// the command is appended to the buffer and the buffer is put back after the request,
+// so the request of each scan is built without allocation.
+var buffers = sync.Pool{
+	New: func() interface{} {
+		buff := make([]byte, 0, 256)
+		return &buff
+	},
+}
+
+// getBuffer returns the empty buffer from buffers.
+func getBuffer() *[]byte {
+	return buffers.Get().(*[]byte)
+}
+
+// putBuffer puts back the buffer to buffers. the buffer must not be used after it.
+func putBuffer(buff *[]byte) {
+	*buff = (*buff)[:0]
+	buffers.Put(buff)
+}
+
+// baseClient implements the commands of Client on top of the transport.
+type baseClient struct {
+	// PLC station
+	stn *station
+	// data communication code
+	code Code
+	// frame transport
+	tr transport
+	// remote password unlocked on connect
+	password string
+}
+
 type client3E struct {
+	baseClient
 	// PLC address
 	tcpAddr *net.TCPAddr
-	// PLC station
-	stn *station
 	// TCP connection
 	conn net.Conn
-	// Mutex to synchronize access to conn
-	mu sync.Mutex
+	// Mutex to synchronize access to conn, frameBuff and rc
+	mu ctxMutex
+	// request frame buffer which is reused by the requests
+	frameBuff []byte
+	// connection state and backoff of the reconnection
+	rc reconnector
+	// deadline and cancel of the request context
+	watcher watcher
 }
 
-func New3EClient(host string, port int, stn *station) (Client, error) {
+func New3EClient(host string, port int, stn *station, opts ...Option) (Client, error) {
 	tcpAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%v:%v", host, port))
 	if err != nil {
 		return nil, err
 	}
-	return &client3E{tcpAddr: tcpAddr, stn: stn}, nil
+	return newClient3E(tcpAddr, stn, newOptions(opts)), nil
+}
+
+func newClient3E(tcpAddr *net.TCPAddr, stn *station, o *options) *client3E {
+	c := &client3E{tcpAddr: tcpAddr, rc: newReconnector(o)}
+	c.baseClient = baseClient{stn: stn, code: o.code, tr: c, password: o.password}
+	return c
+}
+
+const (
+	// max points of one batch read or write request in word units.
+	MAX_WORD_POINTS = 960
+	// max points of one batch read or write request in bit units. if ascii mode then 3584
+	MAX_BIT_POINTS = 7168
+)
+
+// Read is send read as word command to remote plc by mc protocol.
+// deviceName is device code name like 'D' register.
+// offset is device offset addr.
+// numPoints is number of read device points. more than MAX_WORD_POINTS points are read by several requests
+// and returned as one response.
+func (c *baseClient) Read(deviceName string, offset, numPoints int64) ([]byte, error) {
+	return c.ReadContext(context.Background(), deviceName, offset, numPoints)
+}
+
+// ReadContext is Read with the context. the request is canceled when ctx is done.
+func (c *baseClient) ReadContext(ctx context.Context, deviceName string, offset, numPoints int64) ([]byte, error) {
+	if err := c.stn.checkDevices(DeviceAddr{DeviceName: deviceName, Offset: offset}); err != nil {
+		return nil, err
+	}
+	return c.requestChunks(numPoints, MAX_WORD_POINTS, func(start, n int64) ([]byte, error) {
+		buff := getBuffer()
+		defer putBuffer(buff)
+		*buff = c.stn.appendReadCommand(*buff, c.code, deviceName, offset+start, n)
+
+		return c.request(ctx, *buff, c.code.fieldSize(2)*n, c.code.decodeWords)
+	})
+}
+
+// BitRead is send read as bit command to remote plc by mc protocol.
+// deviceName is device code name like 'M' relay.
+// offset is device offset addr.
+// numPoints is number of read device points. two points are packed into one byte.
+// more than MAX_BIT_POINTS points are read by several requests and returned as one response.
+func (c *baseClient) BitRead(deviceName string, offset, numPoints int64) ([]byte, error) {
+	return c.BitReadContext(context.Background(), deviceName, offset, numPoints)
+}
+
+// BitReadContext is BitRead with the context. the request is canceled when ctx is done.
+func (c *baseClient) BitReadContext(ctx context.Context, deviceName string, offset, numPoints int64) ([]byte, error) {
+	if err := c.stn.checkDevices(DeviceAddr{DeviceName: deviceName, Offset: offset}); err != nil {
+		return nil, err
+	}
+	return c.requestChunks(numPoints, c.maxBitPoints(), func(start, n int64) ([]byte, error) {
+		buff := getBuffer()
+		defer putBuffer(buff)
+		*buff = c.stn.appendBitReadCommand(*buff, c.code, deviceName, offset+start, n)
+
+		return c.request(ctx, *buff, c.code.bitDataSize(n), c.code.decodeBits)
+	})
+}
+
+// Write is send write command to remote plc by mc protocol.
+// deviceName is device code name like 'D' register.
+// offset is device offset addr.
+// numPoints is number of write device points.
+// writeData is the data to be written. If writeData is larger than 2*numPoints bytes,
+// data larger than 2*numPoints bytes is ignored. If it is smaller, the rest is written as 0.
+// more than MAX_WORD_POINTS points are written by several requests. the returned response has the header of the
+// first response and the response data of all the requests. the chunked write is not atomic, when a request
+// fails in the middle the points of the previous requests are already written.
+func (c *baseClient) Write(deviceName string, offset, numPoints int64, writeData []byte) ([]byte, error) {
+	return c.WriteContext(context.Background(), deviceName, offset, numPoints, writeData)
+}
+
+// WriteContext is Write with the context. the request is canceled when ctx is done.
+func (c *baseClient) WriteContext(ctx context.Context, deviceName string, offset, numPoints int64, writeData []byte) ([]byte, error) {
+	if err := c.stn.checkDevices(DeviceAddr{DeviceName: deviceName, Offset: offset}); err != nil {
+		return nil, err
+	}
+	return c.requestChunks(numPoints, MAX_WORD_POINTS, func(start, n int64) ([]byte, error) {
+		buff := getBuffer()
+		defer putBuffer(buff)
+		*buff = c.stn.appendWriteCommand(*buff, c.code, deviceName, offset+start, n, chunkData(writeData, 2*start, 2*n))
+
+		return c.request(ctx, *buff, 0, c.code.decodeWords)
+	})
+}
+
+// maxBitPoints returns max points of one request in bit units of the code.
+func (c *baseClient) maxBitPoints() int64 {
+	if c.code == Ascii {
+		return MAX_BIT_POINTS / 2
+	}
+	return MAX_BIT_POINTS
+}
+
+// requestChunks splits numPoints into the chunks of maxPoints and sends the request of each chunk.
+// start is the first point of the chunk and n is number of the points of the chunk.
+// the payloads of the binary responses are joined into one response frame of the first response header.
+func (c *baseClient) requestChunks(numPoints, maxPoints int64, request func(start, n int64) ([]byte, error)) ([]byte, error) {
+	if numPoints <= maxPoints {
+		return request(0, numPoints)
+	}
+
+	var header frame
+	var payload []byte
+	for start := int64(0); start < numPoints; start += maxPoints {
+		n := numPoints - start
+		if n > maxPoints {
+			n = maxPoints
+		}
+		resp, err := request(start, n)
+		if err != nil {
+			return nil, fmt.Errorf("failed to request points %d to %d: %w", start, start+n-1, err)
+		}
+		f, err := parseFrame(Binary, resp)
+		if err != nil {
+			return nil, err
+		}
+		if start == 0 {
+			header = f
+		}
+		payload = append(payload, f.payload...)
+	}
+	return appendBinaryFrame(nil, header, payload), nil
 }
 
-func (c *client3E) Read(deviceName string, offset, numPoints int64) ([]byte, error) {
-	requestStr := c.stn.BuildReadRequest(deviceName, offset, numPoints)
+// chunkData returns size bytes of data from start. out of range is empty, it is written as 0.
+func chunkData(data []byte, start, size int64) []byte {
+	if start >= int64(len(data)) {
+		return nil
+	}
+	end := start + size
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+	return data[start:end]
+}
+
+// ReadRandom is send random read command to remote plc and returns the value of each device.
+// words are read as word (16bit) and dwords are read as double word (32bit).
+// the devices are split into several requests if they are over the points of one request,
+// the requests are sent concurrently.
+func (c *baseClient) ReadRandom(words, dwords []DeviceAddr) (map[DeviceAddr]uint16, map[DeviceAddr]uint32, error) {
+	return c.ReadRandomContext(context.Background(), words, dwords)
+}
+
+// ReadRandomContext is ReadRandom with the context. the request is canceled when ctx is done.
+func (c *baseClient) ReadRandomContext(ctx context.Context, words, dwords []DeviceAddr) (map[DeviceAddr]uint16, map[DeviceAddr]uint32, error) {
+	if err := c.stn.checkDevices(append(append([]DeviceAddr{}, words...), dwords...)...); err != nil {
+		return nil, nil, err
+	}
+	wordValues := make(map[DeviceAddr]uint16, len(words))
+	dwordValues := make(map[DeviceAddr]uint32, len(dwords))
+
+	// MELSEC-Q/L: word points + double word points <= 192, MELSEC iQ-R: <= 96
+	maxPoints := 192
+	if c.stn.series == IQRSeries {
+		maxPoints = 96
+	}
+
+	if len(words)+len(dwords) <= maxPoints {
+		if err := c.readRandom(ctx, words, dwords, wordValues, dwordValues); err != nil {
+			return nil, nil, err
+		}
+		return wordValues, dwordValues, nil
+	}
+
+	// the devices over the limit are read by several requests. the requests are sent concurrently,
+	// so they are pipelined by 4E frame and spread over the connections of Pool.
+	// the rest of the requests are canceled when a request is failed.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	for len(words) > 0 || len(dwords) > 0 {
+		nw := len(words)
+		if nw > maxPoints {
+			nw = maxPoints
+		}
+		nd := len(dwords)
+		if nd > maxPoints-nw {
+			nd = maxPoints - nw
+		}
+		reqWords, reqDWords := words[:nw], dwords[:nd]
+		words, dwords = words[nw:], dwords[nd:]
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reqWordValues := make(map[DeviceAddr]uint16, len(reqWords))
+			reqDWordValues := make(map[DeviceAddr]uint32, len(reqDWords))
+			err := c.readRandom(ctx, reqWords, reqDWords, reqWordValues, reqDWordValues)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				return
+			}
+			for addr, v := range reqWordValues {
+				wordValues[addr] = v
+			}
+			for addr, v := range reqDWordValues {
+				dwordValues[addr] = v
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, nil, firstErr
+	}
+	return wordValues, dwordValues, nil
+}
+
+// readRandom sends random read command of the devices within the limit of one request.
+func (c *baseClient) readRandom(ctx context.Context, words, dwords []DeviceAddr, wordValues map[DeviceAddr]uint16, dwordValues map[DeviceAddr]uint32) error {
+	buff := getBuffer()
+	defer putBuffer(buff)
+	*buff = c.stn.appendRandomReadCommand(*buff, c.code, words, dwords)
+	return c.requestRandom(ctx, *buff, words, dwords, wordValues, dwordValues)
+}
+
+// requestRandom sends the command which response is word data and double word data like random read,
+// and stores the value of each device to wordValues and dwordValues.
+func (c *baseClient) requestRandom(ctx context.Context, command []byte, words, dwords []DeviceAddr, wordValues map[DeviceAddr]uint16, dwordValues map[DeviceAddr]uint32) error {
+	nw, nd := len(words), len(dwords)
+	resp, err := c.request(ctx, command, c.code.fieldSize(2)*int64(nw)+c.code.fieldSize(4)*int64(nd), func(data []byte) ([]byte, error) {
+		if len(data) != 4*nw+8*nd {
+			return nil, fmt.Errorf("random read data length must be %v but %v", 4*nw+8*nd, len(data))
+		}
+		wordData, err := c.code.decodeWords(data[:4*nw])
+		if err != nil {
+			return nil, err
+		}
+		dwordData, err := c.code.decodeDWords(data[4*nw:])
+		return append(wordData, dwordData...), err
+	})
+	if err != nil {
+		return err
+	}
 
-	// TODO binary protocol
-	payload, err := hex.DecodeString(requestStr)
+	payload, err := NewParser().Payload(resp)
+	if err != nil {
+		return err
+	}
+	if len(payload) != 2*nw+4*nd {
+		return fmt.Errorf("random read data length must be %v but %v", 2*nw+4*nd, len(payload))
+	}
+	for i, d := range words {
+		wordValues[d] = binary.LittleEndian.Uint16(payload[2*i:])
+	}
+	for i, d := range dwords {
+		dwordValues[d] = binary.LittleEndian.Uint32(payload[2*nw+4*i:])
+	}
+	return nil
+}
+
+// WriteRandomWords is send random write command of word units to remote plc.
+// words are written as word (16bit) and dwords are written as double word (32bit).
+// all devices are written by one request, so the number of devices is limited by the request size.
+func (c *baseClient) WriteRandomWords(words map[DeviceAddr]uint16, dwords map[DeviceAddr]uint32) error {
+	return c.WriteRandomWordsContext(context.Background(), words, dwords)
+}
+
+// WriteRandomWordsContext is WriteRandomWords with the context. the request is canceled when ctx is done.
+func (c *baseClient) WriteRandomWordsContext(ctx context.Context, words map[DeviceAddr]uint16, dwords map[DeviceAddr]uint32) error {
+	wordAddrs := make([]DeviceAddr, 0, len(words))
+	for d := range words {
+		wordAddrs = append(wordAddrs, d)
+	}
+	sortDeviceAddrs(wordAddrs)
+	wordValues := make([]uint16, len(wordAddrs))
+	for i, d := range wordAddrs {
+		wordValues[i] = words[d]
+	}
+
+	dwordAddrs := make([]DeviceAddr, 0, len(dwords))
+	for d := range dwords {
+		dwordAddrs = append(dwordAddrs, d)
+	}
+	sortDeviceAddrs(dwordAddrs)
+	dwordValues := make([]uint32, len(dwordAddrs))
+	for i, d := range dwordAddrs {
+		dwordValues[i] = dwords[d]
+	}
+
+	// MELSEC-Q/L: word points*12 + double word points*14 <= 1920, MELSEC iQ-R: <= 960
+	maxSize := 1920
+	if c.stn.series == IQRSeries {
+		maxSize = 960
+	}
+	if size := 12*len(wordAddrs) + 14*len(dwordAddrs); size > maxSize {
+		return fmt.Errorf("random write size %v is over the limit %v", size, maxSize)
+	}
+	if err := c.stn.checkDevices(append(wordAddrs, dwordAddrs...)...); err != nil {
+		return err
+	}
+
+	command := c.stn.appendRandomWriteCommand(nil, c.code, wordAddrs, wordValues, dwordAddrs, dwordValues)
+	_, err := c.request(ctx, command, 0, c.code.decodeWords)
+	return err
+}
+
+// WriteRandomBits is send random write command of bit units to remote plc.
+// all devices are written by one request, so the number of devices is limited by the request size.
+func (c *baseClient) WriteRandomBits(bits map[DeviceAddr]bool) error {
+	return c.WriteRandomBitsContext(context.Background(), bits)
+}
+
+// WriteRandomBitsContext is WriteRandomBits with the context. the request is canceled when ctx is done.
+func (c *baseClient) WriteRandomBitsContext(ctx context.Context, bits map[DeviceAddr]bool) error {
+	bitAddrs := make([]DeviceAddr, 0, len(bits))
+	for d := range bits {
+		bitAddrs = append(bitAddrs, d)
+	}
+	sortDeviceAddrs(bitAddrs)
+	values := make([]bool, len(bitAddrs))
+	for i, d := range bitAddrs {
+		values[i] = bits[d]
+	}
+
+	// MELSEC-Q/L: 188 points, MELSEC iQ-R: 94 points
+	maxPoints := 188
+	if c.stn.series == IQRSeries {
+		maxPoints = 94
+	}
+	if len(bitAddrs) > maxPoints {
+		return fmt.Errorf("random write points %v is over the limit %v", len(bitAddrs), maxPoints)
+	}
+	if err := c.stn.checkDevices(bitAddrs...); err != nil {
+		return err
+	}
+
+	command := c.stn.appendRandomBitWriteCommand(nil, c.code, bitAddrs, values)
+	_, err := c.request(ctx, command, 0, c.code.decodeWords)
+	return err
+}
+
+// ReadBlocks is send multiple block batch read command to remote plc.
+// words are word device blocks and bits are bit device blocks read in word units.
+// the data is split back into per block slices in the same order as the blocks.
+func (c *baseClient) ReadBlocks(words, bits []Block) ([][]uint16, [][]uint16, error) {
+	return c.ReadBlocksContext(context.Background(), words, bits)
+}
+
+// ReadBlocksContext is ReadBlocks with the context. the request is canceled when ctx is done.
+func (c *baseClient) ReadBlocksContext(ctx context.Context, words, bits []Block) ([][]uint16, [][]uint16, error) {
+	var points int64
+	for _, b := range append(append([]Block{}, words...), bits...) {
+		points += b.Points
+	}
+	// number of blocks <= 120, total points <= 960
+	if blocks := len(words) + len(bits); blocks > 120 {
+		return nil, nil, fmt.Errorf("number of blocks %v is over the limit %v", blocks, 120)
+	}
+	if points > 960 {
+		return nil, nil, fmt.Errorf("block read points %v is over the limit %v", points, 960)
+	}
+	if err := c.stn.checkBlocks(append(append([]Block{}, words...), bits...)); err != nil {
+		return nil, nil, err
+	}
+
+	command := c.stn.appendBlockReadCommand(nil, c.code, words, bits)
+	resp, err := c.request(ctx, command, c.code.fieldSize(2)*points, c.code.decodeWords)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload, err := NewParser().Payload(resp)
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(payload)) != 2*points {
+		return nil, nil, fmt.Errorf("block read data length must be %v but %v", 2*points, len(payload))
+	}
+
+	split := func(blocks []Block) [][]uint16 {
+		data := make([][]uint16, len(blocks))
+		for i, b := range blocks {
+			data[i] = make([]uint16, b.Points)
+			for j := range data[i] {
+				data[i][j] = binary.LittleEndian.Uint16(payload[2*j:])
+			}
+			payload = payload[2*b.Points:]
+		}
+		return data
+	}
+	wordData := split(words)
+	bitData := split(bits)
+	return wordData, bitData, nil
+}
+
+// WriteBlocks is send multiple block batch write command to remote plc.
+// Data of each block is written, bit device blocks are written in word units.
+// all blocks are written by one request, so the number of points is limited by the request size.
+func (c *baseClient) WriteBlocks(words, bits []Block) error {
+	return c.WriteBlocksContext(context.Background(), words, bits)
+}
+
+// WriteBlocksContext is WriteBlocks with the context. the request is canceled when ctx is done.
+func (c *baseClient) WriteBlocksContext(ctx context.Context, words, bits []Block) error {
+	var points int
+	for _, b := range append(append([]Block{}, words...), bits...) {
+		points += len(b.Data)
+	}
+	// number of blocks <= 120, number of blocks*4 + total points <= 960
+	blocks := len(words) + len(bits)
+	if blocks > 120 {
+		return fmt.Errorf("number of blocks %v is over the limit %v", blocks, 120)
+	}
+	if size := 4*blocks + points; size > 960 {
+		return fmt.Errorf("block write size %v is over the limit %v", size, 960)
+	}
+	if err := c.stn.checkBlocks(append(append([]Block{}, words...), bits...)); err != nil {
+		return err
+	}
+
+	command := c.stn.appendBlockWriteCommand(nil, c.code, words, bits)
+	_, err := c.request(ctx, command, 0, c.code.decodeWords)
+	return err
+}
+
+// HealthCheck is send loopback test command to remote plc and
+// check that the same data is returned.
+func (c *baseClient) HealthCheck() error {
+	return c.HealthCheckContext(context.Background())
+}
+
+// HealthCheckContext is HealthCheck with the context. the request is canceled when ctx is done.
+func (c *baseClient) HealthCheckContext(ctx context.Context) error {
+	command := c.stn.appendHealthCheckCommand(nil, c.code)
+
+	// response data is 折り返しデータ数[2byte] + 折り返しデータ[5byte]
+	resp, err := c.request(ctx, command, c.code.fieldSize(2)+5, func(data []byte) ([]byte, error) {
+		if len(data) < 4 {
+			return data, nil
+		}
+		// only 折り返しデータ数 is word, 折り返しデータ is same on both code.
+		dataNum, err := c.code.decodeWords(data[0:4])
+		return append(dataNum, data[4:]...), err
+	})
+	if err != nil {
+		return err
+	}
+
+	payload, err := NewParser().Payload(resp)
+	if err != nil {
+		return err
+	}
+
+	// payload is 折り返しデータ数[2byte] + 折り返しデータ[5byte]
+	if !bytes.Equal(payload, []byte{0x05, 0x00, 'A', 'B', 'C', 'D', 'E'}) {
+		return fmt.Errorf("plc connect test is fail: return body is [%X]", payload)
+	}
+	return nil
+}
+
+// request sends the command and returns the response frame.
+// response end code is checked, non zero end code is returned as error.
+// dataSize is response data size of the code in normal end without the end code,
+// decode converts the response data to binary code layout.
+// returned frame is always binary code layout whichever the client code is.
+func (c *baseClient) request(ctx context.Context, command []byte, dataSize int64, decode func([]byte) ([]byte, error)) ([]byte, error) {
+	// 11 is response header size. [sub header + network num + unit i/o num + unit station num + response length + response code]
+	resp, err := c.tr.roundTrip(ctx, c.stn, command, c.code.fieldSize(11)+dataSize)
 	if err != nil {
 		return nil, err
 	}
 
-	c.mu.Lock()
+	f, err := c.checkResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.code == Binary {
+		return resp, nil
+	}
+	data, err := decode(f.payload)
+	if err != nil {
+		return nil, err
+	}
+	return appendBinaryFrame(make([]byte, 0, 15+len(data)), f, data), nil
+}
+
+// Route returns the client which sends the requests to the station of route over the same connection.
+// one connection to the gateway ethernet module can access the stations of the whole network.
+// Close of the returned client does nothing, the connection is closed by the original client.
+func (c *baseClient) Route(route AccessRoute) (Client, error) {
+	stn := *c.stn
+	routed := &routeClient{}
+	routed.baseClient = baseClient{stn: stn.SetRoute(route), code: c.code, tr: c.tr, password: c.password}
+	return routed, nil
+}
+
+// routeClient is the client of the other station which shares the transport of the original client.
+type routeClient struct {
+	baseClient
+}
+
+func (c *routeClient) Close() error {
+	return nil
+}
+
+// checkResponse parses the response frame and returns error when end code is not 0000.
+func (c *baseClient) checkResponse(resp []byte) (frame, error) {
+	f, err := parseFrame(c.code, resp)
+	if err != nil {
+		return f, err
+	}
+	return f, f.err()
+}
+
+// roundTrip sends the request and reads the response. the deadline of ctx is set to the connection
+// and the blocking I/O is interrupted when ctx is canceled.
+func (c *client3E) roundTrip(ctx context.Context, stn *station, command []byte, _ int64) ([]byte, error) {
+	// waiting for the previous request or the reconnection is given up when ctx is done
+	if err := c.mu.lockContext(ctx); err != nil {
+		return nil, err
+	}
 	defer c.mu.Unlock()
 
-	// Create connection if it's not already created
+	// Create connection if it's not already created. reconnection is delayed by the backoff.
 	if c.conn == nil {
-		conn, err := net.DialTCP("tcp", nil, c.tcpAddr)
+		conn, err := c.rc.connect(ctx, dialTCP(c.tcpAddr), c.unlockConn)
 		if err != nil {
 			return nil, err
 		}
 		c.conn = conn
+		c.rc.up()
 	}
 
+	c.watcher.watch(ctx, c.conn, readWriteDeadline)
+	defer c.watcher.stop()
+
 	// Send message
-	if _, err = c.conn.Write(payload); err != nil {
+	c.frameBuff = stn.appendFrame3E(c.frameBuff[:0], c.code, command)
+	if _, err := c.conn.Write(c.frameBuff); err != nil {
 		// Close connection on error
-		c.conn.Close()
-		c.conn = nil
-		return nil, err
+		return nil, c.closeConn(contextErr(ctx, err))
 	}
 
-	// Receive message
-	readBuff := make([]byte, 22+2*numPoints) // 22 is response header size. [sub header + network num + unit i/o num + unit station num + response length + response code]
-	readLen, err := c.conn.Read(readBuff)
+	// Receive message. the frame may be split or coalesced by TCP, so exactly one frame is read.
+	resp, err := readFrame(c.conn, c.code, false)
 	if err != nil {
-		// Close connection on error
-		c.conn.Close()
-		c.conn = nil
-		return nil, err
+		// Close connection on error, the rest of the stream can not be framed any more.
+		return nil, c.closeConn(&noResponseError{contextErr(ctx, err)})
 	}
+	return resp, nil
+}
 
-	//return readBuff[:readLen], nil
-	// Process response in a separate goroutine
-	response := readBuff[:readLen]
-	resultChan := make(chan []byte)
-	go func() {
-		resultChan <- response
-	}()
-
-	return <-resultChan, nil
+// closeConn closes the connection by err and returns err. c.mu must be held.
+func (c *client3E) closeConn(err error) error {
+	c.conn.Close()
+	c.conn = nil
+	c.rc.down(err)
+	return err
+}
 
+// unlockConn unlocks remote password of the new connection before it is used by the requests.
+// the password is checked by the connected module, so the unlock is addressed to the local station.
+func (c *client3E) unlockConn(ctx context.Context, conn net.Conn) error {
+	if c.password == "" {
+		return nil
+	}
+	c.watcher.watch(ctx, conn, readWriteDeadline)
+	defer c.watcher.stop()
+	command := c.stn.appendPasswordCommand(nil, c.code, UNLOCK_COMMAND, c.password)
+	if _, err := conn.Write(NewLocalStation().appendFrame3E(nil, c.code, command)); err != nil {
+		return err
+	}
+	resp, err := readFrame(conn, c.code, false)
+	if err != nil {
+		return err
+	}
+	if _, err := c.checkResponse(resp); err != nil {
+		return fmt.Errorf("failed to unlock remote password: %w", err)
+	}
+	return nil
 }
 
 func (c *client3E) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	c.rc.closed()
+	c.watcher.close()
 	if c.conn != nil {
-		return c.conn.Close()
+		err := c.conn.Close()
+		c.conn = nil
+		return err
 	}
 	return nil
 }
+
+// contextErr returns the error of ctx instead of err if the I/O is failed by the deadline or cancel of ctx.
+func contextErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// noResponseError is the error of the request which is sent to the plc but the response is not received,
+// e.g. the connection is closed by the plc before the response. it is transparent to errors.Is and errors.As.
+type noResponseError struct {
+	err error
+}
+
+func (e *noResponseError) Error() string {
+	return e.err.Error()
+}
+
+func (e *noResponseError) Unwrap() error {
+	return e.err
+}
+
+// MAX_RESPONSE_DATA_LEN is the limit of response data length of the frame.
+// the largest response is 960 words batch read (end code + 1920byte, ascii 3844char).
+const MAX_RESPONSE_DATA_LEN = 8192
+
+// readFrame reads one response frame from r.
+// header is read first and then the response data of the data length.
+// the frame which sub header is not response or data length is out of range is rejected.
+func readFrame(r io.Reader, code Code, is4E bool) ([]byte, error) {
+	// sub header + (serial number + 0000) + network num + pc num + unit i/o num + unit station num + response length
+	headerSize := 9
+	subHeader := "D000"
+	if is4E {
+		headerSize += 4
+		subHeader = RESPONSE_SUB_HEADER_4E
+	}
+	if code == Ascii {
+		headerSize *= 2 // 1byte=2char
+	}
+
+	// header is read into the pooled buffer, its capacity is larger than the header.
+	buff := getBuffer()
+	defer putBuffer(buff)
+	header := (*buff)[:headerSize]
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	var expected [4]byte
+	if sub := appendSubHeader(expected[:0], code, subHeader); !bytes.Equal(header[:len(sub)], sub) {
+		return nil, fmt.Errorf("invalid response sub header [%X]", header[0:2])
+	}
+
+	// response length is the last 2byte of the header
+	var dataLen int64
+	if code == Ascii {
+		l, ok := parseHex(header[headerSize-4:])
+		if !ok {
+			return nil, fmt.Errorf("invalid response length [%s]", header[headerSize-4:])
+		}
+		dataLen = int64(l)
+	} else {
+		dataLen = int64(header[headerSize-2]) | int64(header[headerSize-1])<<8
+	}
+	// response data has end code at least
+	if dataLen < code.fieldSize(2) || dataLen > MAX_RESPONSE_DATA_LEN {
+		return nil, fmt.Errorf("invalid response length %v", dataLen)
+	}
+
+	resp := make([]byte, int64(headerSize)+dataLen)
+	copy(resp, header)
+	if _, err := io.ReadFull(r, resp[headerSize:]); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
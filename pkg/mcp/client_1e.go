@@ -0,0 +1,492 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+)
+
+const (
+	// 1E frame has no sub header, command is the first byte of the request.
+	// response first byte is command + 80h.
+	BIT_READ_COMMAND_1E   = "00"
+	WORD_READ_COMMAND_1E  = "01"
+	WORD_WRITE_COMMAND_1E = "03"
+	LOOPBACK_COMMAND_1E   = "16"
+
+	MONITORING_TIMER_1E = "0A00" // 2.5[sec] binary mode expression.
+
+	END_CODE_ABNORMAL_1E = 0x5B // abnormal code follows the end code
+)
+
+// deviceCodes1E is device name and binary mode expression of 1E frame device code.
+// device code is the name padded with space to 2 char. e.g. "D" is "D " (4420h), "TN" is 544Eh.
+// ascii mode sends the device code as 4 hex characters like "4420", not the name itself.
+var deviceCodes1E = map[string]device{
+	"X":  {code: "2058", hex: true},
+	"Y":  {code: "2059", hex: true},
+	"M":  {code: "204D"},
+	"S":  {code: "2053"},
+	"F":  {code: "2046"},
+	"B":  {code: "2042", hex: true},
+	"TN": {code: "4E54"},
+	"TS": {code: "5354"},
+	"CN": {code: "4E43"},
+	"CS": {code: "5343"},
+	"D":  {code: "2044"},
+	"W":  {code: "2057", hex: true},
+	"R":  {code: "2052"},
+}
+
+// client1E is mc protocol client of 1E frame for FX3U-ENET and A series ethernet module.
+// only PC number of the station is used.
+type client1E struct {
+	// PLC address
+	tcpAddr *net.TCPAddr
+	// PLC station
+	stn *station
+	// data communication code
+	code Code
+	// TCP connection
+	conn net.Conn
+	// Mutex to synchronize access to conn and rc
+	mu ctxMutex
+	// connection state and backoff of the reconnection
+	rc reconnector
+	// deadline and cancel of the request context
+	watcher watcher
+}
+
+func New1EClient(host string, port int, stn *station, opts ...Option) (Client, error) {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%v:%v", host, port))
+	if err != nil {
+		return nil, err
+	}
+	o := newOptions(opts)
+	return &client1E{tcpAddr: tcpAddr, stn: stn, code: o.code, rc: newReconnector(o)}, nil
+}
+
+// Read is send batch read in word units command.
+// numPoints is 1 to 256 points.
+func (c *client1E) Read(deviceName string, offset, numPoints int64) ([]byte, error) {
+	return c.ReadContext(context.Background(), deviceName, offset, numPoints)
+}
+
+// ReadContext is Read with the context. the request is canceled when ctx is done.
+func (c *client1E) ReadContext(ctx context.Context, deviceName string, offset, numPoints int64) ([]byte, error) {
+	buff := getBuffer()
+	defer putBuffer(buff)
+	var err error
+	if *buff, err = c.appendRequest(*buff, WORD_READ_COMMAND_1E, deviceName, offset, numPoints, nil); err != nil {
+		return nil, err
+	}
+	return c.request(ctx, *buff, c.code.fieldSize(2)*numPoints, c.code.decodeWords)
+}
+
+// BitRead is send batch read in bit units command.
+// numPoints is 1 to 256 points. two points are packed into one byte.
+func (c *client1E) BitRead(deviceName string, offset, numPoints int64) ([]byte, error) {
+	return c.BitReadContext(context.Background(), deviceName, offset, numPoints)
+}
+
+// BitReadContext is BitRead with the context. the request is canceled when ctx is done.
+func (c *client1E) BitReadContext(ctx context.Context, deviceName string, offset, numPoints int64) ([]byte, error) {
+	buff := getBuffer()
+	defer putBuffer(buff)
+	var err error
+	if *buff, err = c.appendRequest(*buff, BIT_READ_COMMAND_1E, deviceName, offset, numPoints, nil); err != nil {
+		return nil, err
+	}
+	return c.request(ctx, *buff, c.code.bitDataSize(numPoints), c.code.decodeBits)
+}
+
+// Write is send batch write in word units command.
+// writeData is the data to be written. If writeData is larger than 2*numPoints bytes,
+// data larger than 2*numPoints bytes is ignored. If it is smaller, the rest is written as 0.
+func (c *client1E) Write(deviceName string, offset, numPoints int64, writeData []byte) ([]byte, error) {
+	return c.WriteContext(context.Background(), deviceName, offset, numPoints, writeData)
+}
+
+// WriteContext is Write with the context. the request is canceled when ctx is done.
+func (c *client1E) WriteContext(ctx context.Context, deviceName string, offset, numPoints int64, writeData []byte) ([]byte, error) {
+	if err := checkPoints1E(numPoints); err != nil {
+		return nil, err
+	}
+	writeBuff := make([]byte, 2*numPoints) // 2 byte per 1 device point
+	copy(writeBuff, writeData)
+
+	buff := getBuffer()
+	defer putBuffer(buff)
+	var err error
+	if *buff, err = c.appendRequest(*buff, WORD_WRITE_COMMAND_1E, deviceName, offset, numPoints, writeBuff); err != nil {
+		return nil, err
+	}
+	return c.request(ctx, *buff, 0, c.code.decodeWords)
+}
+
+// ReadRandom is not supported by 1E frame.
+func (c *client1E) ReadRandom(words, dwords []DeviceAddr) (map[DeviceAddr]uint16, map[DeviceAddr]uint32, error) {
+	return nil, nil, ErrUnsupported
+}
+
+// ReadRandomContext is not supported by 1E frame.
+func (c *client1E) ReadRandomContext(ctx context.Context, words, dwords []DeviceAddr) (map[DeviceAddr]uint16, map[DeviceAddr]uint32, error) {
+	return nil, nil, ErrUnsupported
+}
+
+// WriteRandomWords is not supported by 1E frame.
+func (c *client1E) WriteRandomWords(words map[DeviceAddr]uint16, dwords map[DeviceAddr]uint32) error {
+	return ErrUnsupported
+}
+
+// WriteRandomWordsContext is not supported by 1E frame.
+func (c *client1E) WriteRandomWordsContext(ctx context.Context, words map[DeviceAddr]uint16, dwords map[DeviceAddr]uint32) error {
+	return ErrUnsupported
+}
+
+// WriteRandomBits is not supported by 1E frame.
+func (c *client1E) WriteRandomBits(bits map[DeviceAddr]bool) error {
+	return ErrUnsupported
+}
+
+// WriteRandomBitsContext is not supported by 1E frame.
+func (c *client1E) WriteRandomBitsContext(ctx context.Context, bits map[DeviceAddr]bool) error {
+	return ErrUnsupported
+}
+
+// ReadBlocks is not supported by 1E frame.
+func (c *client1E) ReadBlocks(words, bits []Block) ([][]uint16, [][]uint16, error) {
+	return nil, nil, ErrUnsupported
+}
+
+// ReadBlocksContext is not supported by 1E frame.
+func (c *client1E) ReadBlocksContext(ctx context.Context, words, bits []Block) ([][]uint16, [][]uint16, error) {
+	return nil, nil, ErrUnsupported
+}
+
+// WriteBlocks is not supported by 1E frame.
+func (c *client1E) WriteBlocks(words, bits []Block) error {
+	return ErrUnsupported
+}
+
+// WriteBlocksContext is not supported by 1E frame.
+func (c *client1E) WriteBlocksContext(ctx context.Context, words, bits []Block) error {
+	return ErrUnsupported
+}
+
+// RegisterMonitor is not supported by 1E frame.
+func (c *client1E) RegisterMonitor(words, dwords []DeviceAddr) (*Monitor, error) {
+	return nil, ErrUnsupported
+}
+
+// RegisterMonitorContext is not supported by 1E frame.
+func (c *client1E) RegisterMonitorContext(ctx context.Context, words, dwords []DeviceAddr) (*Monitor, error) {
+	return nil, ErrUnsupported
+}
+
+// ReadCPUModel is not supported by 1E frame.
+func (c *client1E) ReadCPUModel() (CPUModel, error) {
+	return CPUModel{}, ErrUnsupported
+}
+
+// ReadCPUModelContext is not supported by 1E frame.
+func (c *client1E) ReadCPUModelContext(ctx context.Context) (CPUModel, error) {
+	return CPUModel{}, ErrUnsupported
+}
+
+// ReadMemory is not supported by 1E frame.
+func (c *client1E) ReadMemory(address, numPoints int64) ([]uint16, error) {
+	return nil, ErrUnsupported
+}
+
+// ReadMemoryContext is not supported by 1E frame.
+func (c *client1E) ReadMemoryContext(ctx context.Context, address, numPoints int64) ([]uint16, error) {
+	return nil, ErrUnsupported
+}
+
+// WriteMemory is not supported by 1E frame.
+func (c *client1E) WriteMemory(address int64, values []uint16) error {
+	return ErrUnsupported
+}
+
+// WriteMemoryContext is not supported by 1E frame.
+func (c *client1E) WriteMemoryContext(ctx context.Context, address int64, values []uint16) error {
+	return ErrUnsupported
+}
+
+// ReadModuleBuffer is not supported by 1E frame.
+func (c *client1E) ReadModuleBuffer(startIO uint16, address, numPoints int64) ([]uint16, error) {
+	return nil, ErrUnsupported
+}
+
+// ReadModuleBufferContext is not supported by 1E frame.
+func (c *client1E) ReadModuleBufferContext(ctx context.Context, startIO uint16, address, numPoints int64) ([]uint16, error) {
+	return nil, ErrUnsupported
+}
+
+// WriteModuleBuffer is not supported by 1E frame.
+func (c *client1E) WriteModuleBuffer(startIO uint16, address int64, values []uint16) error {
+	return ErrUnsupported
+}
+
+// WriteModuleBufferContext is not supported by 1E frame.
+func (c *client1E) WriteModuleBufferContext(ctx context.Context, startIO uint16, address int64, values []uint16) error {
+	return ErrUnsupported
+}
+
+// Route is not supported by 1E frame.
+func (c *client1E) Route(route AccessRoute) (Client, error) {
+	return nil, ErrUnsupported
+}
+
+// Unlock is not supported by 1E frame.
+func (c *client1E) Unlock(password string) error {
+	return ErrUnsupported
+}
+
+// UnlockContext is not supported by 1E frame.
+func (c *client1E) UnlockContext(ctx context.Context, password string) error {
+	return ErrUnsupported
+}
+
+// Lock is not supported by 1E frame.
+func (c *client1E) Lock(password string) error {
+	return ErrUnsupported
+}
+
+// LockContext is not supported by 1E frame.
+func (c *client1E) LockContext(ctx context.Context, password string) error {
+	return ErrUnsupported
+}
+
+// RemoteRun is not supported by 1E frame.
+func (c *client1E) RemoteRun(force bool, clear ClearMode, confirm Confirm) error {
+	return ErrUnsupported
+}
+
+// RemoteRunContext is not supported by 1E frame.
+func (c *client1E) RemoteRunContext(ctx context.Context, force bool, clear ClearMode, confirm Confirm) error {
+	return ErrUnsupported
+}
+
+// RemoteStop is not supported by 1E frame.
+func (c *client1E) RemoteStop(confirm Confirm) error {
+	return ErrUnsupported
+}
+
+// RemoteStopContext is not supported by 1E frame.
+func (c *client1E) RemoteStopContext(ctx context.Context, confirm Confirm) error {
+	return ErrUnsupported
+}
+
+// RemotePause is not supported by 1E frame.
+func (c *client1E) RemotePause(force bool, confirm Confirm) error {
+	return ErrUnsupported
+}
+
+// RemotePauseContext is not supported by 1E frame.
+func (c *client1E) RemotePauseContext(ctx context.Context, force bool, confirm Confirm) error {
+	return ErrUnsupported
+}
+
+// RemoteLatchClear is not supported by 1E frame.
+func (c *client1E) RemoteLatchClear(confirm Confirm) error {
+	return ErrUnsupported
+}
+
+// RemoteLatchClearContext is not supported by 1E frame.
+func (c *client1E) RemoteLatchClearContext(ctx context.Context, confirm Confirm) error {
+	return ErrUnsupported
+}
+
+// RemoteReset is not supported by 1E frame.
+func (c *client1E) RemoteReset(confirm Confirm) error {
+	return ErrUnsupported
+}
+
+// RemoteResetContext is not supported by 1E frame.
+func (c *client1E) RemoteResetContext(ctx context.Context, confirm Confirm) error {
+	return ErrUnsupported
+}
+
+// HealthCheck is send loopback test command to remote plc and
+// check that the same data is returned.
+func (c *client1E) HealthCheck() error {
+	return c.HealthCheckContext(context.Background())
+}
+
+// HealthCheckContext is HealthCheck with the context. the request is canceled when ctx is done.
+func (c *client1E) HealthCheckContext(ctx context.Context) error {
+	buff := getBuffer()
+	defer putBuffer(buff)
+	*buff = c.code.appendHex(*buff, LOOPBACK_COMMAND_1E)
+	*buff = c.code.appendHex(*buff, c.stn.pcNum)
+	*buff = c.code.appendHex(*buff, MONITORING_TIMER_1E)
+	*buff = c.code.appendUint(*buff, 5, 1) // 5 byte.
+	*buff = append(*buff, "ABCDE"...)      // 折り返しデータ is same on both code.
+
+	resp, err := c.request(ctx, *buff, c.code.fieldSize(1)+5, func(data []byte) ([]byte, error) {
+		if len(data) < 2 {
+			return data, nil
+		}
+		// only 折り返しデータ数 is converted.
+		dataNum, ok := parseHex(data[0:2])
+		if !ok {
+			return nil, fmt.Errorf("invalid loopback data number [%s]", data[0:2])
+		}
+		return append([]byte{byte(dataNum)}, data[2:]...), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// payload is 折り返しデータ数[1byte] + 折り返しデータ[5byte]
+	if !bytes.Equal(resp[2:], []byte{0x05, 'A', 'B', 'C', 'D', 'E'}) {
+		return fmt.Errorf("plc connect test is fail: return body is [%X]", resp[2:])
+	}
+	return nil
+}
+
+// appendRequest appends 1E frame request to dst in the code expression.
+// 1E frame is command + PC number + monitoring timer + head device + device code + points + 00 + data.
+// ascii head device is device code + device number.
+func (c *client1E) appendRequest(dst []byte, command, deviceName string, offset, numPoints int64, data []byte) ([]byte, error) {
+	dev, ok := deviceCodes1E[deviceName]
+	if !ok {
+		return dst, fmt.Errorf("device %s is not supported by 1E frame", deviceName)
+	}
+	if err := checkPoints1E(numPoints); err != nil {
+		return dst, err
+	}
+
+	dst = c.code.appendHex(dst, command)
+	dst = c.code.appendHex(dst, c.stn.pcNum)
+	dst = c.code.appendHex(dst, MONITORING_TIMER_1E)
+	if c.code == Ascii {
+		// ascii device code is 4 char like "4420", head device is 8 char.
+		dst = c.code.appendHex(dst, dev.code)
+		dst = c.code.appendUint(dst, offset, 4)
+	} else {
+		dst = c.code.appendUint(dst, offset, 4)
+		dst = c.code.appendHex(dst, dev.code)
+	}
+	dst = c.code.appendUint(dst, numPoints%256, 1) // 256 points is 00
+	dst = c.code.appendUint(dst, 0, 1)             // 固定値
+	return c.code.appendWords(dst, data), nil
+}
+
+// checkPoints1E returns error if numPoints is out of 1 to 256 points of 1E frame batch command.
+func checkPoints1E(numPoints int64) error {
+	if numPoints < 1 || numPoints > 256 {
+		return fmt.Errorf("number of points must be 1 to 256 but %v", numPoints)
+	}
+	return nil
+}
+
+// request sends 1E frame request and returns the response frame.
+// 1E response has no data length, so dataSize is response data size of the code in normal end.
+// returned frame is always binary code layout whichever the client code is.
+func (c *client1E) request(ctx context.Context, request []byte, dataSize int64, decode func([]byte) ([]byte, error)) ([]byte, error) {
+	// waiting for the previous request or the reconnection is given up when ctx is done
+	if err := c.mu.lockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer c.mu.Unlock()
+
+	// Create connection if it's not already created. reconnection is delayed by the backoff.
+	if c.conn == nil {
+		conn, err := c.rc.connect(ctx, dialTCP(c.tcpAddr), nil)
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+		c.rc.up()
+	}
+
+	c.watcher.watch(ctx, c.conn, readWriteDeadline)
+	resp, err := c.exchange(request, dataSize)
+	c.watcher.stop()
+	if err != nil {
+		// Close connection on error
+		c.conn.Close()
+		c.conn = nil
+		err = contextErr(ctx, err)
+		c.rc.down(err)
+		return nil, err
+	}
+
+	f, err := parseFrame1E(c.code, resp)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.err(); err != nil {
+		return nil, err
+	}
+
+	if c.code == Binary {
+		return resp, nil
+	}
+	data, err := decode(f.payload)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{f.subHeader, f.endCode}, data...), nil
+}
+
+// exchange writes the request and reads sub header and end code, and then the rest of the response.
+func (c *client1E) exchange(request []byte, dataSize int64) ([]byte, error) {
+	if _, err := c.conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	headerSize := c.code.fieldSize(2) // sub header + end code
+	resp := make([]byte, headerSize)
+	if _, err := io.ReadFull(c.conn, resp); err != nil {
+		return nil, err
+	}
+
+	f, err := parseFrame1E(c.code, resp)
+	if err != nil {
+		return nil, err
+	}
+	switch f.endCode {
+	case 0x00:
+	case END_CODE_ABNORMAL_1E:
+		dataSize = c.code.fieldSize(1) // abnormal code
+	default:
+		dataSize = 0
+	}
+
+	data := make([]byte, dataSize)
+	if _, err := io.ReadFull(c.conn, data); err != nil {
+		return nil, err
+	}
+	return append(resp, data...), nil
+}
+
+func (c *client1E) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rc.closed()
+	c.watcher.close()
+	if c.conn != nil {
+		err := c.conn.Close()
+		c.conn = nil
+		return err
+	}
+	return nil
+}
+
+// is1E reports whether the response is 1E frame. 1E response first byte is 80h to 9Fh.
+func is1E(code Code, resp []byte) bool {
+	if len(resp) == 0 {
+		return false
+	}
+	if code == Ascii {
+		return resp[0] == '8' || resp[0] == '9'
+	}
+	return resp[0]&0xE0 == 0x80
+}
@@ -0,0 +1,158 @@
+package mcp
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestClient1E_BuildRequest(t *testing.T) {
+	c := &client1E{stn: NewLocalStation(), code: Binary}
+	request, err := c.appendRequest(nil, WORD_READ_COMMAND_1E, "D", 100, 3, nil)
+	if err != nil {
+		t.Fatalf("unexpected build err: %v", err)
+	}
+	if actual, expected := Binary.string(request), "01FF0A00"+"640000002044"+"0300"; actual != expected {
+		t.Errorf("expected %v but actual is %v", expected, actual)
+	}
+
+	if _, err := c.appendRequest(nil, WORD_READ_COMMAND_1E, "ZR", 0, 1, nil); err == nil {
+		t.Errorf("expected unsupported device error but nil")
+	}
+}
+
+func TestClient1E_BuildRequestAscii(t *testing.T) {
+	cases := []struct {
+		command    string
+		deviceName string
+		offset     int64
+		numPoints  int64
+		expected   string
+	}{
+		// device code is 4 hex characters of the binary code, D is 4420h and X is 5820h.
+		{command: WORD_READ_COMMAND_1E, deviceName: "D", offset: 100, numPoints: 3, expected: "01FF000A" + "4420" + "00000064" + "0300"},
+		{command: BIT_READ_COMMAND_1E, deviceName: "X", offset: 0x1F, numPoints: 256, expected: "00FF000A" + "5820" + "0000001F" + "0000"},
+		{command: WORD_READ_COMMAND_1E, deviceName: "TN", offset: 5, numPoints: 1, expected: "01FF000A" + "544E" + "00000005" + "0100"},
+	}
+
+	c := &client1E{stn: NewLocalStation(), code: Ascii}
+	for _, v := range cases {
+		request, err := c.appendRequest(nil, v.command, v.deviceName, v.offset, v.numPoints, nil)
+		if err != nil {
+			t.Fatalf("unexpected build err: %v", err)
+		}
+		if actual := string(request); actual != v.expected {
+			t.Errorf("expected %v but actual is %v", v.expected, actual)
+		}
+	}
+
+	// write data is 4 hex characters of each word from the upper byte
+	request, err := c.appendRequest(nil, WORD_WRITE_COMMAND_1E, "D", 0, 2, []byte{0x34, 0x12, 0xCD, 0xAB})
+	if err != nil {
+		t.Fatalf("unexpected build err: %v", err)
+	}
+	if actual, expected := string(request), "03FF000A"+"4420"+"00000000"+"0200"+"1234ABCD"; actual != expected {
+		t.Errorf("expected %v but actual is %v", expected, actual)
+	}
+}
+
+func TestClient1E_LocalServer(t *testing.T) {
+	host, port := servePLC(t,
+		"81 00 3412 cdab",     // word read
+		"80 00 10",            // bit read
+		"83 00",               // write
+		"96 00 05 4142434445", // loopback
+		"81 5b 10",            // abnormal
+	)
+
+	client, err := New1EClient(host, port, NewLocalStation())
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	resp, err := client.Read("D", 0, 2)
+	if err != nil {
+		t.Fatalf("unexpected mcp read err: %v", err)
+	}
+	if hex.EncodeToString(resp) != "81003412cdab" {
+		t.Fatalf("unexpected read response %x", resp)
+	}
+	response, err := NewParser().Do(resp)
+	if err != nil {
+		t.Fatalf("unexpected parser err: %v", err)
+	}
+	if hex.EncodeToString(response.Payload) != "3412cdab" {
+		t.Fatalf("unexpected payload %x", response.Payload)
+	}
+
+	resp, err = client.BitRead("M", 0, 2)
+	if err != nil {
+		t.Fatalf("unexpected mcp bit read err: %v", err)
+	}
+	if hex.EncodeToString(resp) != "800010" {
+		t.Fatalf("unexpected bit read response %x", resp)
+	}
+
+	if _, err := client.Write("D", 0, 1, []byte{0x01, 0x00}); err != nil {
+		t.Fatalf("unexpected mcp write err: %v", err)
+	}
+
+	if err := client.HealthCheck(); err != nil {
+		t.Fatalf("unexpected health check err: %v", err)
+	}
+
+	_, err = client.Read("D", 0, 1)
+	var endCodeErr *EndCodeError
+	if !errors.As(err, &endCodeErr) {
+		t.Fatalf("expected EndCodeError but actual is %v", err)
+	}
+	if endCodeErr.EndCode != 0x5B || endCodeErr.AbnormalCode != 0x10 {
+		t.Errorf("unexpected end code error %+v", *endCodeErr)
+	}
+}
+
+func TestClient1E_WriteInvalidPoints(t *testing.T) {
+	c := &client1E{stn: NewLocalStation(), code: Binary}
+	for _, numPoints := range []int64{-1, 0, 257, 1 << 40} {
+		if _, err := c.Write("D", 0, numPoints, nil); err == nil {
+			t.Errorf("expected number of points error for %v but nil", numPoints)
+		}
+	}
+}
+
+func TestClient1E_LocalServerAscii(t *testing.T) {
+	host, port := servePLC(t,
+		hex.EncodeToString([]byte("81001234ABCD")), // word read
+		hex.EncodeToString([]byte("960005ABCDE")),  // loopback
+		hex.EncodeToString([]byte("815B10")),       // abnormal
+	)
+
+	client, err := New1EClient(host, port, NewLocalStation(), WithCode(Ascii))
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	// ascii response is converted to binary code layout
+	resp, err := client.Read("D", 0, 2)
+	if err != nil {
+		t.Fatalf("unexpected mcp read err: %v", err)
+	}
+	if hex.EncodeToString(resp) != "81003412cdab" {
+		t.Fatalf("unexpected read response %x", resp)
+	}
+
+	if err := client.HealthCheck(); err != nil {
+		t.Fatalf("unexpected health check err: %v", err)
+	}
+
+	_, err = client.Read("D", 0, 1)
+	var endCodeErr *EndCodeError
+	if !errors.As(err, &endCodeErr) {
+		t.Fatalf("expected EndCodeError but actual is %v", err)
+	}
+	if endCodeErr.EndCode != 0x5B || endCodeErr.AbnormalCode != 0x10 {
+		t.Errorf("unexpected end code error %+v", *endCodeErr)
+	}
+}
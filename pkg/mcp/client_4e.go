@@ -0,0 +1,202 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// client4E is mc protocol client of 4E frame.
+// Each request has its serial number, so several requests can be in flight on one connection
+// and the responses are matched back by the serial number.
+type client4E struct {
+	baseClient
+	// PLC address
+	tcpAddr *net.TCPAddr
+	// TCP connection
+	conn net.Conn
+	// Mutex to synchronize access to conn, frameBuff, serial, pending and rc
+	mu ctxMutex
+	// request frame buffer which is reused by the requests
+	frameBuff []byte
+	// serial number of the next request
+	serial uint16
+	// requests waiting for the response. key is serial number.
+	pending map[uint16]chan result
+	// connection state and backoff of the reconnection
+	rc reconnector
+	// write deadline and cancel of the request context
+	watcher watcher
+}
+
+// result is the response frame or error of the request.
+type result struct {
+	resp []byte
+	err  error
+}
+
+func New4EClient(host string, port int, stn *station, opts ...Option) (Client, error) {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%v:%v", host, port))
+	if err != nil {
+		return nil, err
+	}
+	o := newOptions(opts)
+	c := &client4E{tcpAddr: tcpAddr, pending: map[uint16]chan result{}, rc: newReconnector(o)}
+	c.baseClient = baseClient{stn: stn, code: o.code, tr: c, password: o.password}
+	return c, nil
+}
+
+// roundTrip sends the request and waits for the response of the serial number.
+// waiting is canceled when ctx is done, the late response is discarded by receive.
+// the connection is closed when the deadline of ctx is exceeded, so a dead connection is not kept.
+func (c *client4E) roundTrip(ctx context.Context, stn *station, command []byte, _ int64) ([]byte, error) {
+	// waiting for the previous request or the reconnection is given up when ctx is done
+	if err := c.mu.lockContext(ctx); err != nil {
+		return nil, err
+	}
+
+	// Create connection if it's not already created. reconnection is delayed by the backoff.
+	if c.conn == nil {
+		conn, err := c.rc.connect(ctx, dialTCP(c.tcpAddr), c.unlockConn)
+		if err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+		c.conn = conn
+		c.rc.up()
+		go c.receive(conn)
+	}
+	conn := c.conn
+
+	// skip serial number which is still waiting for the response
+	for {
+		if _, ok := c.pending[c.serial]; !ok {
+			break
+		}
+		c.serial++
+	}
+	serial := c.serial
+	c.serial++
+
+	resultCh := make(chan result, 1)
+	c.pending[serial] = resultCh
+
+	// Send message. only write deadline is set, the connection is read by receive at the same time.
+	c.frameBuff = stn.appendFrame4E(c.frameBuff[:0], c.code, serial, command)
+	c.watcher.watch(ctx, c.conn, writeDeadline)
+	_, err := c.conn.Write(c.frameBuff)
+	c.watcher.stop()
+	if err != nil {
+		// Close connection on error
+		err = contextErr(ctx, err)
+		c.closeConn(err)
+		c.mu.Unlock()
+		return nil, err
+	}
+	c.mu.Unlock()
+
+	// Wait for the response without holding the lock, next request can be sent meanwhile.
+	select {
+	case r := <-resultCh:
+		return r.resp, r.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.pending, serial)
+		// no response by the deadline means the connection may be half-open, receive would wait on it forever.
+		// the connection is closed and reconnected by the next request unless it is already replaced.
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && c.conn == conn {
+			c.closeConn(&noResponseError{fmt.Errorf("no response by the deadline: %w", ctx.Err())})
+		}
+		return nil, &noResponseError{ctx.Err()}
+	}
+}
+
+// unlockConn unlocks remote password of the new connection before the receive goroutine is started.
+// the password is checked by the connected module, so the unlock is addressed to the local station.
+// no other request is in flight on the new connection, so the response is read here. c.mu must be held.
+func (c *client4E) unlockConn(ctx context.Context, conn net.Conn) error {
+	if c.password == "" {
+		return nil
+	}
+	c.watcher.watch(ctx, conn, readWriteDeadline)
+	defer c.watcher.stop()
+	serial := c.serial
+	c.serial++
+	command := c.stn.appendPasswordCommand(nil, c.code, UNLOCK_COMMAND, c.password)
+	if _, err := conn.Write(NewLocalStation().appendFrame4E(nil, c.code, serial, command)); err != nil {
+		return err
+	}
+	resp, err := readFrame(conn, c.code, true)
+	if err != nil {
+		return err
+	}
+	if _, err := c.checkResponse(resp); err != nil {
+		return fmt.Errorf("failed to unlock remote password: %w", err)
+	}
+	return nil
+}
+
+// receive reads response frames from conn and passes them to the waiting request.
+func (c *client4E) receive(conn net.Conn) {
+	for {
+		resp, err := readFrame(conn, c.code, true)
+		if err != nil {
+			c.mu.Lock()
+			if c.conn == conn {
+				// the waiting requests are already sent
+				c.closeConn(&noResponseError{err})
+			}
+			c.mu.Unlock()
+			return
+		}
+
+		f, err := parseFrame(c.code, resp)
+		if err != nil {
+			continue
+		}
+
+		c.mu.Lock()
+		resultCh, ok := c.pending[f.serial]
+		delete(c.pending, f.serial)
+		c.mu.Unlock()
+
+		// response of unknown serial number is discarded
+		if ok {
+			resultCh <- result{resp: resp}
+		}
+	}
+}
+
+// closeConn closes the connection and fails all waiting requests by err. c.mu must be held.
+func (c *client4E) closeConn(err error) {
+	c.dropConn(err)
+	c.rc.down(err)
+}
+
+// dropConn closes the connection and fails all waiting requests by err without the state change. c.mu must be held.
+func (c *client4E) dropConn(err error) error {
+	closeErr := c.conn.Close()
+	c.conn = nil
+	for serial, resultCh := range c.pending {
+		resultCh <- result{err: err}
+		delete(c.pending, serial)
+	}
+	return closeErr
+}
+
+func (c *client4E) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rc.closed()
+	c.watcher.close()
+	if c.conn != nil {
+		return c.dropConn(errClosed)
+	}
+	return nil
+}
+
+// errClosed is returned to the requests waiting for the response when the client is closed.
+var errClosed = errors.New("client is closed")
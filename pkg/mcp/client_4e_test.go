@@ -0,0 +1,144 @@
+package mcp
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient4E_Pipelined(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	// server receives 2 requests and answers them in reverse order.
+	// response data is the low byte of the serial number.
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var serials [][]byte
+		for i := 0; i < 2; i++ {
+			req, err := readRequest(conn, true)
+			if err != nil {
+				return
+			}
+			serials = append(serials, req[2:4])
+		}
+		for i := len(serials) - 1; i >= 0; i-- {
+			resp, _ := hex.DecodeString("d400" + hex.EncodeToString(serials[i]) + "0000" + "00ffff0300" + "0400" + "0000")
+			resp = append(resp, serials[i][0], 0x00)
+			if _, err := conn.Write(resp); err != nil {
+				return
+			}
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	client, err := New4EClient(addr.IP.String(), addr.Port, NewLocalStation())
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	resps := make([][]byte, 2)
+	errs := make([]error, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resps[i], errs[i] = client.Read("D", int64(i), 1)
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[byte]bool{}
+	for i := 0; i < 2; i++ {
+		if errs[i] != nil {
+			t.Fatalf("unexpected mcp read err: %v", errs[i])
+		}
+		f, err := parseFrame(Binary, resps[i])
+		if err != nil {
+			t.Fatalf("unexpected parser err: %v", err)
+		}
+		if !f.is4E {
+			t.Fatalf("response is not 4E frame: %X", resps[i])
+		}
+		if f.payload[0] != byte(f.serial) {
+			t.Fatalf("response of serial %v has data of serial %v", f.serial, f.payload[0])
+		}
+		seen[byte(f.serial)] = true
+	}
+	if len(seen) != 2 {
+		t.Fatalf("expected 2 different serial numbers but %v", seen)
+	}
+}
+
+func TestClient4E_ResponseTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	// plc accepts the connections but never answers like the half-open connection
+	var accepted int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			go io.Copy(io.Discard, conn)
+		}
+	}()
+
+	var mu sync.Mutex
+	var states []ConnState
+	handler := func(state ConnState, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		states = append(states, state)
+	}
+	addr := ln.Addr().(*net.TCPAddr)
+	backoff := Backoff{Min: time.Millisecond, Max: time.Millisecond, Multiplier: 1}
+	client, err := New4EClient(addr.IP.String(), addr.Port, NewLocalStation(), WithBackoff(backoff), WithStateHandler(handler))
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err := client.ReadContext(ctx, "D", 0, 1)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded but actual is %v", err)
+		}
+	}
+	// the connection of the timed out request is closed and the next request redials
+	if n := atomic.LoadInt32(&accepted); n != 2 {
+		t.Errorf("expected 2 connections but actual is %v", n)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []ConnState{StateConnecting, StateUp, StateDown, StateConnecting, StateUp, StateDown}
+	if fmt.Sprint(states) != fmt.Sprint(expected) {
+		t.Errorf("expected states %v but actual is %v", expected, states)
+	}
+}
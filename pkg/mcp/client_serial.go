@@ -0,0 +1,405 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// SerialFormat is the message format of 3C and 4C frame which is configured on the serial communication module (C24).
+type SerialFormat int
+
+const (
+	// Format1 is ascii frame. request begins with ENQ, response begins with STX, ACK or NAK.
+	Format1 SerialFormat = iota + 1
+	// Format2 is Format1 with the block number after the control code.
+	Format2
+	// Format3 is ascii frame enclosed with STX and ETX. response has QACK or QNAK.
+	Format3
+	// Format4 is Format1 terminated with CR LF.
+	Format4
+	// Format5 is binary frame enclosed with DLE STX and DLE ETX. only 4C frame supports it.
+	Format5
+)
+
+// control codes of the serial frame
+const (
+	STX = 0x02
+	ETX = 0x03
+	ENQ = 0x05
+	ACK = 0x06
+	DLE = 0x10
+	NAK = 0x15
+	CR  = 0x0D
+	LF  = 0x0A
+)
+
+const (
+	FRAME_ID_3C = 0xF9
+	FRAME_ID_4C = 0xF8 // ascii is "F8".
+
+	// response ID code of Format5 response
+	RESPONSE_ID_4C = 0xFFFF
+
+	// self-station number of the request. it is 00 except the linked multidrop.
+	SELF_STATION_NUM = 0x00
+)
+
+// clientSerial is mc protocol client of 3C or 4C frame over the serial communication module (C24).
+// the frame is read and written on any io.ReadWriter like serial port, and the response is converted to
+// 3E response frame of the same code, so the commands are same as 3E client.
+// the deadline of ctx is set to rw if it has SetDeadline (e.g. net.Conn), otherwise I/O is not interrupted.
+type clientSerial struct {
+	baseClient
+	// serial port
+	rw io.ReadWriter
+	// buffered reader of rw
+	r *bufio.Reader
+	// Mutex to synchronize access to rw, frameBuff and block
+	mu ctxMutex
+	// request frame buffer which is reused by the requests
+	frameBuff []byte
+	// message format
+	format SerialFormat
+	// 4C frame is used, otherwise 3C frame
+	is4C bool
+	// station number of the C24 module
+	stationNum uint8
+	// sum check code is added to the frame
+	sumCheck bool
+	// block number of the next Format2 request
+	block uint8
+	// deadline and cancel of the request context if rw has SetDeadline
+	watcher watcher
+}
+
+// New3CClient returns the client of 3C frame on rw. format is Format1 to Format4.
+func New3CClient(rw io.ReadWriter, format SerialFormat, stn *station, opts ...Option) (Client, error) {
+	if format < Format1 || format > Format4 {
+		return nil, fmt.Errorf("unsupported 3C frame format: %d", format)
+	}
+	return newSerialClient(rw, format, false, stn, opts), nil
+}
+
+// New4CClient returns the client of 4C frame on rw. format is Format1 to Format5.
+func New4CClient(rw io.ReadWriter, format SerialFormat, stn *station, opts ...Option) (Client, error) {
+	if format < Format1 || format > Format5 {
+		return nil, fmt.Errorf("unsupported 4C frame format: %d", format)
+	}
+	return newSerialClient(rw, format, true, stn, opts), nil
+}
+
+func newSerialClient(rw io.ReadWriter, format SerialFormat, is4C bool, stn *station, opts []Option) *clientSerial {
+	o := newOptions(opts)
+	// Format5 is binary, the others are ascii regardless of the code option
+	code := Ascii
+	if format == Format5 {
+		code = Binary
+	}
+	c := &clientSerial{
+		rw:         rw,
+		r:          bufio.NewReader(rw),
+		format:     format,
+		is4C:       is4C,
+		stationNum: o.stationNum,
+		sumCheck:   o.sumCheck,
+	}
+	c.baseClient = baseClient{stn: stn, code: code, tr: c, password: o.password}
+	return c
+}
+
+func (c *clientSerial) roundTrip(ctx context.Context, stn *station, command []byte, _ int64) ([]byte, error) {
+	// waiting for the previous request is given up when ctx is done
+	if err := c.mu.lockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer c.mu.Unlock()
+
+	if d, ok := c.rw.(deadliner); ok {
+		c.watcher.watch(ctx, d, readWriteDeadline)
+		defer c.watcher.stop()
+	}
+
+	block := c.block
+	c.block++
+	c.frameBuff = c.appendFrame(c.frameBuff[:0], stn, block, command)
+	if _, err := c.rw.Write(c.frameBuff); err != nil {
+		return nil, contextErr(ctx, err)
+	}
+
+	var resp []byte
+	var err error
+	if c.format == Format5 {
+		resp, err = c.readBinary()
+	} else {
+		resp, err = c.readAscii(block)
+	}
+	if err != nil {
+		// the rest of the response can not be framed any more
+		c.r.Reset(c.rw)
+		return nil, &noResponseError{contextErr(ctx, err)}
+	}
+	return resp, nil
+}
+
+// appendRoute appends the station number of C24, the access route of the station and the self-station number to dst.
+// 3C frame has no request destination module.
+func (c *clientSerial) appendRoute(dst []byte, stn *station) []byte {
+	dst = c.code.appendUint(dst, int64(c.stationNum), 1)
+	if c.is4C {
+		dst = stn.appendAccessPath(dst, c.code)
+	} else {
+		dst = c.code.appendHex(dst, stn.networkNum)
+		dst = c.code.appendHex(dst, stn.pcNum)
+	}
+	return c.code.appendUint(dst, SELF_STATION_NUM, 1)
+}
+
+// routeSize returns byte size of the route of the response.
+func (c *clientSerial) routeSize() int {
+	if c.is4C {
+		return int(c.code.fieldSize(7))
+	}
+	return int(c.code.fieldSize(4))
+}
+
+func (c *clientSerial) frameID() byte {
+	if c.is4C {
+		return FRAME_ID_4C
+	}
+	return FRAME_ID_3C
+}
+
+// appendFrame appends the request frame of the format to dst.
+func (c *clientSerial) appendFrame(dst []byte, stn *station, block uint8, requestData []byte) []byte {
+	if c.format == Format5 {
+		// number of data bytes is from frame ID to the end of request data
+		body := getBuffer()
+		defer putBuffer(body)
+		*body = Binary.appendUint(*body, int64(1+c.routeSize()+len(requestData)), 2)
+		*body = append(*body, FRAME_ID_4C)
+		*body = c.appendRoute(*body, stn)
+		*body = append(*body, requestData...)
+
+		dst = append(dst, DLE, STX)
+		for _, b := range *body {
+			// DLE in the data is sent twice
+			if b == DLE {
+				dst = append(dst, DLE)
+			}
+			dst = append(dst, b)
+		}
+		dst = append(dst, DLE, ETX)
+		if c.sumCheck {
+			dst = appendSumCheck(dst, *body)
+		}
+		return dst
+	}
+
+	// sum check is from the block number (Format3 is from the frame ID) to the end of the frame
+	control := byte(ENQ)
+	if c.format == Format3 {
+		control = STX
+	}
+	dst = append(dst, control)
+	start := len(dst)
+	if c.format == Format2 {
+		dst = Ascii.appendUint(dst, int64(block), 1)
+	}
+	dst = Ascii.appendUint(dst, int64(c.frameID()), 1)
+	dst = c.appendRoute(dst, stn)
+	dst = append(dst, requestData...)
+	if c.format == Format3 {
+		dst = append(dst, ETX)
+	}
+	if c.sumCheck {
+		dst = appendSumCheck(dst, dst[start:])
+	}
+	if c.format == Format4 {
+		dst = append(dst, CR, LF)
+	}
+	return dst
+}
+
+// readAscii reads the response of Format1 to Format4 and converts it to 3E ascii response frame.
+func (c *clientSerial) readAscii(block uint8) ([]byte, error) {
+	control, err := c.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	headerSize := 2 + c.routeSize() // frame ID + route
+	if c.format == Format2 {
+		headerSize += 2 // block number
+	}
+	var body []byte
+	switch {
+	case control == STX:
+		// response data is terminated by ETX and followed by the sum check code
+		body, err = c.r.ReadBytes(ETX)
+		if err == nil && c.sumCheck {
+			err = c.readSumCheck(body)
+		}
+		if err == nil {
+			body = body[:len(body)-1]
+		}
+	case control == ACK && c.format != Format3:
+		body = make([]byte, headerSize)
+		_, err = io.ReadFull(c.r, body)
+	case control == NAK && c.format != Format3:
+		body = make([]byte, headerSize+4) // error code
+		_, err = io.ReadFull(c.r, body)
+	default:
+		return nil, fmt.Errorf("invalid control code %02X of the response", control)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.format == Format4 {
+		crlf := make([]byte, 2)
+		if _, err := io.ReadFull(c.r, crlf); err != nil {
+			return nil, err
+		}
+		if crlf[0] != CR || crlf[1] != LF {
+			return nil, fmt.Errorf("response is not terminated by CR LF: %X", crlf)
+		}
+	}
+
+	if len(body) < headerSize {
+		return nil, fmt.Errorf("response is too short: %q", body)
+	}
+	if c.format == Format2 {
+		if b, ok := parseHex(body[0:2]); !ok || b != uint64(block) {
+			return nil, fmt.Errorf("block number %s of the response does not match the request %02X", body[0:2], block)
+		}
+		body = body[2:]
+	}
+	if id, ok := parseHex(body[0:2]); !ok || id != uint64(c.frameID()) {
+		return nil, fmt.Errorf("invalid frame ID %s of the response", body[0:2])
+	}
+	route, data := body[2:2+c.routeSize()], body[2+c.routeSize():]
+
+	endCode := []byte("0000")
+	switch {
+	case c.format == Format3 && bytes.HasPrefix(data, []byte("QACK")):
+		data = data[4:]
+	case c.format == Format3 && bytes.HasPrefix(data, []byte("QNAK")):
+		endCode, data = data[4:], nil
+	case control == NAK:
+		endCode, data = data, nil
+	}
+	if len(endCode) != 4 {
+		return nil, fmt.Errorf("invalid error code %q of the response", endCode)
+	}
+
+	resp := make([]byte, 0, 22+len(data))
+	resp = append(resp, "D000"...)
+	// network num + PC num + unit I/O num + unit station num. 3C response has no module.
+	if c.is4C {
+		resp = append(resp, route[2:12]...)
+	} else {
+		resp = append(resp, route[2:6]...)
+		resp = append(resp, "03FF00"...)
+	}
+	resp = Ascii.appendUint(resp, int64(len(endCode)+len(data)), 2)
+	resp = append(resp, endCode...)
+	return append(resp, data...), nil
+}
+
+// readBinary reads the response of Format5 and converts it to 3E binary response frame.
+func (c *clientSerial) readBinary() ([]byte, error) {
+	start := make([]byte, 2)
+	if _, err := io.ReadFull(c.r, start); err != nil {
+		return nil, err
+	}
+	if start[0] != DLE || start[1] != STX {
+		return nil, fmt.Errorf("response does not begin with DLE STX: %X", start)
+	}
+
+	buff := getBuffer()
+	defer putBuffer(buff)
+	body := *buff
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == DLE {
+			// DLE DLE is DLE in the data, DLE ETX is the end of the data
+			if b, err = c.r.ReadByte(); err != nil {
+				return nil, err
+			}
+			if b == ETX {
+				break
+			}
+			if b != DLE {
+				return nil, fmt.Errorf("invalid DLE sequence %02X of the response", b)
+			}
+		}
+		body = append(body, b)
+	}
+	*buff = body
+	if c.sumCheck {
+		if err := c.readSumCheck(body); err != nil {
+			return nil, err
+		}
+	}
+
+	// number of data bytes + frame ID + route + response ID code + end code
+	headerSize := 2 + 1 + c.routeSize() + 2 + 2
+	if len(body) < headerSize {
+		return nil, fmt.Errorf("response is too short: %X", body)
+	}
+	if n := int(body[0]) | int(body[1])<<8; n != len(body)-2 {
+		return nil, fmt.Errorf("number of data bytes %d of the response does not match %d", n, len(body)-2)
+	}
+	if body[2] != FRAME_ID_4C {
+		return nil, fmt.Errorf("invalid frame ID %02X of the response", body[2])
+	}
+	if id := binary.LittleEndian.Uint16(body[headerSize-4:]); id != RESPONSE_ID_4C {
+		return nil, fmt.Errorf("invalid response ID code %04X of the response", id)
+	}
+
+	// network num + PC num + unit I/O num + unit station num
+	rest := body[headerSize-2:] // end code + response data or error information
+	resp := make([]byte, 0, 9+len(rest))
+	resp = append(resp, 0xD0, 0x00)
+	resp = append(resp, body[4:9]...)
+	resp = Binary.appendUint(resp, int64(len(rest)), 2)
+	return append(resp, rest...), nil
+}
+
+// readSumCheck reads the sum check code and compares it with the sum of data.
+func (c *clientSerial) readSumCheck(data []byte) error {
+	sum := make([]byte, 2)
+	if _, err := io.ReadFull(c.r, sum); err != nil {
+		return err
+	}
+	var expected [2]byte
+	appendSumCheck(expected[:0], data)
+	if !bytes.Equal(sum, expected[:]) {
+		return fmt.Errorf("sum check error: received %s but calculated %s", sum, expected)
+	}
+	return nil
+}
+
+// appendSumCheck appends the lower byte of the sum of data as 2 ascii characters to dst.
+func appendSumCheck(dst []byte, data []byte) []byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return appendHexByte(dst, sum)
+}
+
+// Close stops watching the request context, rw is closed by the owner.
+func (c *clientSerial) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.watcher.close()
+	return nil
+}
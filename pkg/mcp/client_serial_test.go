@@ -0,0 +1,184 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// testSum returns sum check code of s.
+func testSum(s string) string {
+	var sum int
+	for _, b := range []byte(s) {
+		sum += int(b)
+	}
+	return fmt.Sprintf("%02X", sum&0xFF)
+}
+
+// serveC24 starts the serial module on the pipe which checks each request and answers the response.
+func serveC24(t *testing.T, exchanges ...[2]string) net.Conn {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	go func() {
+		buff := make([]byte, 1024)
+		for _, ex := range exchanges {
+			n, err := server.Read(buff)
+			if err != nil {
+				return
+			}
+			if !bytes.Equal(buff[:n], []byte(ex[0])) {
+				t.Errorf("expected request %q but actual is %q", ex[0], buff[:n])
+				return
+			}
+			if _, err := server.Write([]byte(ex[1])); err != nil {
+				return
+			}
+		}
+	}()
+	return client
+}
+
+func TestClientSerial_Read(t *testing.T) {
+	const (
+		read4C = "F80000FF03FF0000" + "04010000D*0001000002"
+		resp4C = "F80000FF03FF0000" + "12340001"
+		read3C = "F90000FF00" + "04010000D*0001000002"
+		resp3C = "F90000FF00" + "12340001"
+	)
+	expected := []byte{0xd0, 0x00, 0x00, 0xff, 0xff, 0x03, 0x00, 0x06, 0x00, 0x00, 0x00, 0x34, 0x12, 0x01, 0x00}
+
+	tests := []struct {
+		name      string
+		is4C      bool
+		format    SerialFormat
+		req, resp string
+	}{
+		{"4C format 1", true, Format1,
+			"\x05" + read4C + testSum(read4C),
+			"\x02" + resp4C + "\x03" + testSum(resp4C+"\x03")},
+		{"4C format 2", true, Format2,
+			"\x05" + "00" + read4C + testSum("00"+read4C),
+			"\x02" + "00" + resp4C + "\x03" + testSum("00"+resp4C+"\x03")},
+		{"4C format 3", true, Format3,
+			"\x02" + read4C + "\x03" + testSum(read4C+"\x03"),
+			"\x02" + resp4C[:16] + "QACK" + resp4C[16:] + "\x03" + testSum(resp4C[:16]+"QACK"+resp4C[16:]+"\x03")},
+		{"4C format 4", true, Format4,
+			"\x05" + read4C + testSum(read4C) + "\r\n",
+			"\x02" + resp4C + "\x03" + testSum(resp4C+"\x03") + "\r\n"},
+		{"3C format 1", false, Format1,
+			"\x05" + read3C + testSum(read3C),
+			"\x02" + resp3C + "\x03" + testSum(resp3C+"\x03")},
+		{"3C format 4", false, Format4,
+			"\x05" + read3C + testSum(read3C) + "\r\n",
+			"\x02" + resp3C + "\x03" + testSum(resp3C+"\x03") + "\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := serveC24(t, [2]string{tt.req, tt.resp})
+			newClient := New3CClient
+			if tt.is4C {
+				newClient = New4CClient
+			}
+			client, err := newClient(rw, tt.format, NewLocalStation())
+			if err != nil {
+				t.Fatalf("unexpected client err: %v", err)
+			}
+			resp, err := client.Read("D", 100, 2)
+			if err != nil {
+				t.Fatalf("unexpected mcp read err: %v", err)
+			}
+			if !bytes.Equal(resp, expected) {
+				t.Fatalf("expected %X but actual is %X", expected, resp)
+			}
+		})
+	}
+}
+
+func TestClientSerial_Format5(t *testing.T) {
+	// DLE (10h) in the data is doubled
+	req := "\x12\x00\xf8\x00\x00\xff\xff\x03\x00\x00\x01\x04\x00\x00\x64\x00\x00\xa8\x02\x00"
+	resp := "\x10\x00\xf8\x00\x00\xff\xff\x03\x00\x00\xff\xff\x00\x00\x10\x10\x01\x00"
+	rw := serveC24(t, [2]string{
+		"\x10\x02" + req + "\x10\x03" + testSum(req),
+		"\x10\x02" + "\x10\x10\x00\xf8\x00\x00\xff\xff\x03\x00\x00\xff\xff\x00\x00\x10\x10\x10\x10\x01\x00" + "\x10\x03" + testSum(resp),
+	})
+	client, err := New4CClient(rw, Format5, NewLocalStation())
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	actual, err := client.Read("D", 100, 2)
+	if err != nil {
+		t.Fatalf("unexpected mcp read err: %v", err)
+	}
+	expected := []byte{0xd0, 0x00, 0x00, 0xff, 0xff, 0x03, 0x00, 0x06, 0x00, 0x00, 0x00, 0x10, 0x10, 0x01, 0x00}
+	if !bytes.Equal(actual, expected) {
+		t.Fatalf("expected %X but actual is %X", expected, actual)
+	}
+}
+
+func TestClientSerial_Response(t *testing.T) {
+	const (
+		write = "F80000FF03FF0000" + "14010000D*0001000001" + "0005"
+		route = "F80000FF03FF0000"
+	)
+	rw := serveC24(t,
+		// normal end without data
+		[2]string{"\x05" + write + testSum(write), "\x06" + route},
+		// abnormal end
+		[2]string{"\x05" + write + testSum(write), "\x15" + route + "C051"},
+		// sum check error
+		[2]string{"\x05" + write + testSum(write), "\x02" + route + "\x03" + "00"},
+	)
+	client, err := New4CClient(rw, Format1, NewLocalStation())
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+
+	if _, err := client.Write("D", 100, 1, []byte{0x05, 0x00}); err != nil {
+		t.Fatalf("unexpected mcp write err: %v", err)
+	}
+
+	_, err = client.Write("D", 100, 1, []byte{0x05, 0x00})
+	var endCodeErr *EndCodeError
+	if !errors.As(err, &endCodeErr) || endCodeErr.EndCode != 0xC051 {
+		t.Fatalf("expected end code C051 but %v", err)
+	}
+
+	if _, err := client.Write("D", 100, 1, []byte{0x05, 0x00}); err == nil {
+		t.Fatalf("expected sum check error but nil")
+	}
+}
+
+func TestClientSerial_Context(t *testing.T) {
+	// serial module never responds
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go func() {
+		buff := make([]byte, 1024)
+		for {
+			if _, err := server.Read(buff); err != nil {
+				return
+			}
+		}
+	}()
+
+	c, err := New4CClient(client, Format1, NewLocalStation(), WithSumCheck(false))
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.ReadContext(ctx, "D", 100, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded but %v", err)
+	}
+}
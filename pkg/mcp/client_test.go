@@ -1,11 +1,21 @@
 package mcp
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
+	"io"
+	"net"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"nk2-PLCcapture-go/pkg/mcp/mcptest"
 )
 
 var (
@@ -22,16 +32,24 @@ func init() {
 	}
 }
 
-func TestClient3E_Read(t *testing.T) {
-	// running only when there is and plc that can be accepted mc protocol
-	if testPLCHost == "" {
-		t.Skip("environment variable PLC_TEST_HOST is not set")
+// testPLC returns the address of the plc of the tests. PLC_TEST_HOST and PLC_TEST_PORT are the plc
+// that can be accepted mc protocol, mcptest plc is started if they are not set.
+func testPLC(t *testing.T) (string, int) {
+	t.Helper()
+	if testPLCHost != "" && testPLCPort != 0 {
+		return testPLCHost, testPLCPort
 	}
-	if testPLCPort == 0 {
-		t.Skip("environment variable PLC_TEST_PORT is not set")
+	plc, err := mcptest.NewServer()
+	if err != nil {
+		t.Fatalf("failed to start mcptest plc: %v", err)
 	}
+	t.Cleanup(func() { plc.Close() })
+	return plc.Host(), plc.Port()
+}
 
-	client, err := New3EClient(testPLCHost, testPLCPort, NewLocalStation())
+func TestClient3E_Read(t *testing.T) {
+	host, port := testPLC(t)
+	client, err := New3EClient(host, port, NewLocalStation())
 	if err != nil {
 		t.Fatalf("PLC does not exists? %v", err)
 	}
@@ -66,15 +84,8 @@ func TestClient3E_Read(t *testing.T) {
 }
 
 func TestClient3E_BitRead(t *testing.T) {
-	// running only when there is and plc that can be accepted mc protocol
-	if testPLCHost == "" {
-		t.Skip("environment variable PLC_TEST_HOST is not set")
-	}
-	if testPLCPort == 0 {
-		t.Skip("environment variable PLC_TEST_PORT is not set")
-	}
-
-	client, err := New3EClient(testPLCHost, testPLCPort, NewLocalStation())
+	host, port := testPLC(t)
+	client, err := New3EClient(host, port, NewLocalStation())
 	if err != nil {
 		t.Fatalf("PLC does not exists? %v", err)
 	}
@@ -122,40 +133,558 @@ func TestClient3E_BitRead(t *testing.T) {
 }
 
 func TestClient3E_Write(t *testing.T) {
-	// running only when there is and plc that can be accepted mc protocol
-	if testPLCHost == "" {
-		t.Skip("environment variable PLC_TEST_HOST is not set")
+	host, port := testPLC(t)
+	client, err := New3EClient(host, port, NewLocalStation())
+	if err != nil {
+		t.Fatalf("PLC does not exists? %v", err)
 	}
-	if testPLCPort == 0 {
-		t.Skip("environment variable PLC_TEST_PORT is not set")
+
+	_, err = client.Write("D", 100, 4, []byte("test"))
+	if err != nil {
+		t.Fatalf("unexpected mcp write err: %v", err)
 	}
+}
 
-	client, err := New3EClient(testPLCHost, testPLCPort, NewLocalStation())
+func TestClient3E_Ping(t *testing.T) {
+	host, port := testPLC(t)
+	client, err := New3EClient(host, port, NewLocalStation())
 	if err != nil {
 		t.Fatalf("PLC does not exists? %v", err)
 	}
 
-	_, err = client.Write("D", 100, 4, []byte("test"))
+	if err := client.HealthCheck(); err != nil {
+		t.Fatalf("unexpected error occured %v", err)
+	}
+}
+
+// servePLC starts tcp server that answers each request with the next response in resps.
+func servePLC(t *testing.T, resps ...string) (string, int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buff := make([]byte, 1024)
+		for _, r := range resps {
+			if _, err := conn.Read(buff); err != nil {
+				return
+			}
+			resp, _ := hex.DecodeString(strings.ReplaceAll(r, " ", ""))
+			if _, err := conn.Write(resp); err != nil {
+				return
+			}
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+// readRequest reads one binary 3E or 4E request frame.
+func readRequest(r io.Reader, is4E bool) ([]byte, error) {
+	// sub header + (serial number + 0000) + network num + pc num + unit i/o num + unit station num + request length
+	headerSize := 9
+	if is4E {
+		headerSize += 4
+	}
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	req := make([]byte, headerSize+int(binary.LittleEndian.Uint16(header[headerSize-2:])))
+	copy(req, header)
+	if _, err := io.ReadFull(r, req[headerSize:]); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func TestClient3E_LocalServer(t *testing.T) {
+	host, port := servePLC(t,
+		"d000 00 ff ff03 00 0300 0000 10",                     // bit read
+		"d000 00 ff ff03 00 0200 0000",                        // write
+		"d000 00 ff ff03 00 0900 0000 0500 4142434445",        // health check
+		"d000 00 ff ff03 00 0b00 51c0 00ff ff03 00 0104 0000", // error end code
+	)
+
+	client, err := New3EClient(host, port, NewLocalStation())
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	resp, err := client.BitRead("M", 0, 2)
+	if err != nil {
+		t.Fatalf("unexpected mcp bit read err: %v", err)
+	}
+	if hex.EncodeToString(resp) != "d00000ffff030003000000"+"10" {
+		t.Fatalf("unexpected bit read response %x", resp)
+	}
+
+	if _, err := client.Write("D", 100, 1, []byte{0x01, 0x00}); err != nil {
 		t.Fatalf("unexpected mcp write err: %v", err)
 	}
+
+	if err := client.HealthCheck(); err != nil {
+		t.Fatalf("unexpected health check err: %v", err)
+	}
+
+	if _, err := client.Read("D", 0, 1000); err == nil {
+		t.Fatalf("expected end code error but nil")
+	}
 }
 
-func TestClient3E_Ping(t *testing.T) {
-	// running only when there is and plc that can be accepted mc protocol
-	if testPLCHost == "" {
-		t.Skip("environment variable PLC_TEST_HOST is not set")
+func TestClient3E_LocalServerAscii(t *testing.T) {
+	host, port := servePLC(t,
+		hex.EncodeToString([]byte("D00000FF03FF00000C00001234ABCD")),  // read
+		hex.EncodeToString([]byte("D00000FF03FF0000070000101")),       // bit read
+		hex.EncodeToString([]byte("D00000FF03FF00000D00000005ABCDE")), // health check
+	)
+
+	client, err := New3EClient(host, port, NewLocalStation(), WithCode(Ascii))
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	resp, err := client.Read("D", 0, 2)
+	if err != nil {
+		t.Fatalf("unexpected mcp read err: %v", err)
 	}
-	if testPLCPort == 0 {
-		t.Skip("environment variable PLC_TEST_PORT is not set")
+	if hex.EncodeToString(resp) != "d00000ffff030006000000"+"3412cdab" {
+		t.Fatalf("unexpected read response %x", resp)
 	}
 
-	client, err := New3EClient(testPLCHost, testPLCPort, NewLocalStation())
+	resp, err = client.BitRead("M", 0, 3)
 	if err != nil {
-		t.Fatalf("PLC does not exists? %v", err)
+		t.Fatalf("unexpected mcp bit read err: %v", err)
+	}
+	if hex.EncodeToString(resp) != "d00000ffff030004000000"+"1010" {
+		t.Fatalf("unexpected bit read response %x", resp)
 	}
 
 	if err := client.HealthCheck(); err != nil {
-		t.Fatalf("unexpected error occured %v", err)
+		t.Fatalf("unexpected health check err: %v", err)
+	}
+}
+
+func TestClient3E_ReadRandom(t *testing.T) {
+	host, port := servePLC(t,
+		"d000 00 ff ff03 00 0a00 0000 3412 0100 78563412",
+	)
+
+	client, err := New3EClient(host, port, NewLocalStation())
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	d300 := DeviceAddr{DeviceName: "D", Offset: 300}
+	m16 := DeviceAddr{DeviceName: "M", Offset: 16}
+	d400 := DeviceAddr{DeviceName: "D", Offset: 400}
+
+	words, dwords, err := client.ReadRandom([]DeviceAddr{d300, m16}, []DeviceAddr{d400})
+	if err != nil {
+		t.Fatalf("unexpected mcp random read err: %v", err)
+	}
+	if words[d300] != 0x1234 || words[m16] != 0x0001 {
+		t.Fatalf("unexpected word values %v", words)
+	}
+	if dwords[d400] != 0x12345678 {
+		t.Fatalf("unexpected double word values %v", dwords)
+	}
+}
+
+func TestClient3E_WriteRandom(t *testing.T) {
+	host, port := servePLC(t,
+		"d000 00 ff ff03 00 0200 0000",
+		"d000 00 ff ff03 00 0200 0000",
+	)
+
+	client, err := New3EClient(host, port, NewLocalStation())
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	err = client.WriteRandomWords(
+		map[DeviceAddr]uint16{{DeviceName: "D", Offset: 300}: 0x1234},
+		map[DeviceAddr]uint32{{DeviceName: "D", Offset: 400}: 0x12345678},
+	)
+	if err != nil {
+		t.Fatalf("unexpected mcp random write err: %v", err)
+	}
+
+	if err := client.WriteRandomBits(map[DeviceAddr]bool{{DeviceName: "M", Offset: 24}: true}); err != nil {
+		t.Fatalf("unexpected mcp random bit write err: %v", err)
+	}
+
+	tooMany := map[DeviceAddr]bool{}
+	for i := 0; i < 189; i++ {
+		tooMany[DeviceAddr{DeviceName: "M", Offset: int64(i)}] = true
+	}
+	if err := client.WriteRandomBits(tooMany); err == nil {
+		t.Fatalf("expected over the limit error but nil")
+	}
+}
+
+func TestClient3E_ReadBlocks(t *testing.T) {
+	host, port := servePLC(t,
+		"d000 00 ff ff03 00 0800 0000 0100 0200 ff00",
+	)
+
+	client, err := New3EClient(host, port, NewLocalStation())
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	words, bits, err := client.ReadBlocks(
+		[]Block{{DeviceAddr: DeviceAddr{DeviceName: "D", Offset: 0}, Points: 2}},
+		[]Block{{DeviceAddr: DeviceAddr{DeviceName: "M", Offset: 16}, Points: 1}},
+	)
+	if err != nil {
+		t.Fatalf("unexpected mcp block read err: %v", err)
+	}
+	if len(words) != 1 || len(words[0]) != 2 || words[0][0] != 1 || words[0][1] != 2 {
+		t.Fatalf("unexpected word blocks %v", words)
+	}
+	if len(bits) != 1 || len(bits[0]) != 1 || bits[0][0] != 0xFF {
+		t.Fatalf("unexpected bit blocks %v", bits)
+	}
+}
+
+func TestClient3E_Framing(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	read1, _ := hex.DecodeString("d00000ffff0300040000000100")
+	read2, _ := hex.DecodeString("d00000ffff0300040000000200")
+	invalid, _ := hex.DecodeString("d00000ffff0300ffff0000")
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// first response is split into 2 segments
+		if _, err := readRequest(conn, false); err != nil {
+			return
+		}
+		conn.Write(read1[:5])
+		time.Sleep(10 * time.Millisecond)
+		conn.Write(read1[5:])
+
+		// 2 responses are coalesced into 1 segment
+		if _, err := readRequest(conn, false); err != nil {
+			return
+		}
+		conn.Write(append(append([]byte{}, read1...), read2...))
+
+		// response data length is over the limit
+		for i := 0; i < 2; i++ {
+			if _, err := readRequest(conn, false); err != nil {
+				return
+			}
+		}
+		conn.Write(invalid)
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	client, err := New3EClient(addr.IP.String(), addr.Port, NewLocalStation())
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	for _, expected := range [][]byte{read1, read1, read2} {
+		resp, err := client.Read("D", 0, 1)
+		if err != nil {
+			t.Fatalf("unexpected mcp read err: %v", err)
+		}
+		if !bytes.Equal(resp, expected) {
+			t.Fatalf("expected %X but actual is %X", expected, resp)
+		}
+	}
+
+	if _, err := client.Read("D", 0, 1); err == nil {
+		t.Fatalf("expected invalid frame error but nil")
+	}
+}
+
+func TestClient_Context(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	// plc never responds
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, conn)
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	for name, newClient := range map[string]func(string, int, *station, ...Option) (Client, error){
+		"3E": New3EClient,
+		"4E": New4EClient,
+	} {
+		t.Run(name, func(t *testing.T) {
+			client, err := newClient(addr.IP.String(), addr.Port, NewLocalStation())
+			if err != nil {
+				t.Fatalf("unexpected client err: %v", err)
+			}
+			defer client.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			if _, err := client.ReadContext(ctx, "D", 0, 1); !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("expected deadline exceeded but %v", err)
+			}
+
+			ctx, cancel = context.WithCancel(context.Background())
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				cancel()
+			}()
+			if _, err := client.ReadContext(ctx, "D", 0, 1); !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected canceled but %v", err)
+			}
+		})
+	}
+}
+
+func TestClient3E_Chunks(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	// plc answers word read with the device number of each point, bit read with ON of the odd points
+	// and records the points of the requests.
+	var mu sync.Mutex
+	var points []int
+	written := map[int]uint16{}
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			req, err := readRequest(conn, false)
+			if err != nil {
+				return
+			}
+			// monitoring timer + command + sub command + device number + device code + points
+			command := binary.LittleEndian.Uint16(req[11:13])
+			subCommand := binary.LittleEndian.Uint16(req[13:15])
+			devNum := int(req[15]) | int(req[16])<<8 | int(req[17])<<16
+			numPoints := int(binary.LittleEndian.Uint16(req[19:21]))
+			mu.Lock()
+			points = append(points, numPoints)
+
+			var data []byte
+			switch {
+			case command == 0x0401 && subCommand == 0x0000:
+				for i := 0; i < numPoints; i++ {
+					data = append(data, byte(devNum+i), byte((devNum+i)>>8))
+				}
+			case command == 0x0401 && subCommand == 0x0001:
+				data = make([]byte, (numPoints+1)/2)
+				for i := 0; i < numPoints; i++ {
+					if (devNum+i)%2 == 1 {
+						data[i/2] |= 0x10 >> (4 * uint(i%2))
+					}
+				}
+			case command == 0x1401:
+				for i := 0; i < numPoints; i++ {
+					written[devNum+i] = binary.LittleEndian.Uint16(req[21+2*i:])
+				}
+			}
+			mu.Unlock()
+			resp := []byte{0xd0, 0x00, 0x00, 0xff, 0xff, 0x03, 0x00}
+			resp = append(resp, byte(2+len(data)), byte((2+len(data))>>8))
+			resp = append(resp, 0x00, 0x00)
+			if _, err := conn.Write(append(resp, data...)); err != nil {
+				return
+			}
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	client, err := New3EClient(addr.IP.String(), addr.Port, NewLocalStation())
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	// words
+	resp, err := client.Read("D", 100, 2000)
+	if err != nil {
+		t.Fatalf("unexpected mcp read err: %v", err)
+	}
+	response, err := NewParser().Do(resp)
+	if err != nil {
+		t.Fatalf("unexpected parser err: %v", err)
+	}
+	if len(response.Payload) != 4000 || response.DataLen != "A20F" {
+		t.Fatalf("unexpected response length %v data length %s", len(response.Payload), response.DataLen)
+	}
+	for i := 0; i < 2000; i++ {
+		if v := binary.LittleEndian.Uint16(response.Payload[2*i:]); v != uint16(100+i) {
+			t.Fatalf("D%d: expected %d but actual is %d", 100+i, 100+i, v)
+		}
+	}
+
+	// bits
+	resp, err = client.BitRead("M", 0, 10000)
+	if err != nil {
+		t.Fatalf("unexpected mcp bit read err: %v", err)
+	}
+	response, err = NewParser().Do(resp)
+	if err != nil {
+		t.Fatalf("unexpected parser err: %v", err)
+	}
+	if len(response.Payload) != 5000 {
+		t.Fatalf("unexpected response length %v", len(response.Payload))
+	}
+	for i, b := range response.Payload {
+		if b != 0x01 {
+			t.Fatalf("M%d: unexpected bits %02X", 2*i, b)
+		}
+	}
+
+	// write
+	writeData := make([]byte, 2*1000)
+	for i := 0; i < 1000; i++ {
+		binary.LittleEndian.PutUint16(writeData[2*i:], uint16(i))
+	}
+	if _, err := client.Write("D", 0, 1000, writeData); err != nil {
+		t.Fatalf("unexpected mcp write err: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 0; i < 1000; i++ {
+		if written[i] != uint16(i) {
+			t.Fatalf("D%d: expected %d but written %d", i, i, written[i])
+		}
+	}
+
+	expected := []int{960, 960, 80, 7168, 2832, 960, 40}
+	if len(points) != len(expected) {
+		t.Fatalf("expected points of the requests %v but actual is %v", expected, points)
+	}
+	for i := range expected {
+		if points[i] != expected[i] {
+			t.Fatalf("expected points of the requests %v but actual is %v", expected, points)
+		}
+	}
+}
+
+// replayTransport frames the command like client3E and replays the response frame,
+// so the allocations of the client are measured without the network.
+type replayTransport struct {
+	code  Code
+	resp  []byte
+	frame []byte
+	r     bytes.Reader
+}
+
+func (t *replayTransport) roundTrip(_ context.Context, stn *station, command []byte, _ int64) ([]byte, error) {
+	t.frame = stn.appendFrame3E(t.frame[:0], t.code, command)
+	t.r.Reset(t.resp)
+	return readFrame(&t.r, t.code, false)
+}
+
+func BenchmarkClient3E_Read(b *testing.B) {
+	cases := []struct {
+		name string
+		code Code
+		resp []byte
+	}{
+		// D100-D103 are 1, 2, 3, 4
+		{name: "binary", code: Binary, resp: []byte("\xD0\x00\x00\xFF\xFF\x03\x00\x0A\x00\x00\x00\x01\x00\x02\x00\x03\x00\x04\x00")},
+		{name: "ascii", code: Ascii, resp: []byte("D00000FF03FF00001400000001000200030004")},
+	}
+	for _, v := range cases {
+		client := &baseClient{stn: NewLocalStation(), code: v.code, tr: &replayTransport{code: v.code, resp: v.resp}}
+		b.Run(v.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := client.Read("D", 100, 4); err != nil {
+					b.Fatalf("unexpected mcp read err: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkClient3E_ReadContext(b *testing.B) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	// plc responds to every request
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, err := readRequest(conn, false); err != nil {
+				return
+			}
+			if _, err := conn.Write([]byte("\xD0\x00\x00\xFF\xFF\x03\x00\x04\x00\x00\x00\x01\x00")); err != nil {
+				return
+			}
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	client, err := New3EClient(addr.IP.String(), addr.Port, NewLocalStation())
+	if err != nil {
+		b.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	cancelable, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, v := range []struct {
+		name string
+		ctx  context.Context
+	}{
+		{name: "background", ctx: context.Background()},
+		{name: "cancelable", ctx: cancelable},
+	} {
+		b.Run(v.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := client.ReadContext(v.ctx, "D", 0, 1); err != nil {
+					b.Fatalf("unexpected mcp read err: %v", err)
+				}
+			}
+		})
 	}
 }
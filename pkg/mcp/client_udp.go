@@ -0,0 +1,231 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// clientUDP is mc protocol client of 3E or 4E frame over UDP.
+// one datagram is one frame. the request is sent again when the response is not received in the timeout.
+// 4E response is matched by the serial number, so a late response of the previous request is discarded
+// and a late response of the resent request is accepted.
+// 3E response has no serial number, so the datagrams received before the request are discarded
+// and the response which size does not match the request is discarded.
+type clientUDP struct {
+	baseClient
+	// PLC address
+	udpAddr *net.UDPAddr
+	// UDP connection
+	conn *net.UDPConn
+	// Mutex to synchronize access to conn, frameBuff, datagram, serial and rc
+	mu ctxMutex
+	// request frame and received datagram buffers which are reused by the requests
+	frameBuff []byte
+	datagram  []byte
+	// 4E frame is used
+	is4E bool
+	// serial number of the next 4E request
+	serial uint16
+	// time to wait for the response of one datagram
+	timeout time.Duration
+	// number of resends when the response is not received
+	retries int
+	// connection state and backoff of the reconnection
+	rc reconnector
+	// read deadline and cancel of the request context
+	watcher watcher
+}
+
+func New3EUDPClient(host string, port int, stn *station, opts ...Option) (Client, error) {
+	return newUDPClient(host, port, stn, false, opts)
+}
+
+func New4EUDPClient(host string, port int, stn *station, opts ...Option) (Client, error) {
+	return newUDPClient(host, port, stn, true, opts)
+}
+
+func newUDPClient(host string, port int, stn *station, is4E bool, opts []Option) (Client, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%v:%v", host, port))
+	if err != nil {
+		return nil, err
+	}
+	o := newOptions(opts)
+	c := &clientUDP{udpAddr: udpAddr, is4E: is4E, timeout: o.timeout, retries: o.retries, rc: newReconnector(o)}
+	c.baseClient = baseClient{stn: stn, code: o.code, tr: c, password: o.password}
+	return c, nil
+}
+
+func (c *clientUDP) roundTrip(ctx context.Context, stn *station, command []byte, respSize int64) ([]byte, error) {
+	// waiting for the previous request or the reconnection is given up when ctx is done
+	if err := c.mu.lockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer c.mu.Unlock()
+
+	// Create connection if it's not already created. reconnection is delayed by the backoff.
+	// UDP has no connection, so the plc is up when the response is received.
+	if c.conn == nil {
+		conn, err := c.rc.connect(ctx, c.dial, func(ctx context.Context, conn net.Conn) error {
+			c.conn = conn.(*net.UDPConn)
+			return c.unlock(ctx)
+		})
+		if err != nil {
+			c.conn = nil
+			return nil, err
+		}
+		c.conn = conn.(*net.UDPConn)
+	}
+
+	resp, err := c.exchange(ctx, stn, command, respSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			// Close connection on error, the plc may be restarted and the password is unlocked again.
+			c.conn.Close()
+			c.conn = nil
+			c.rc.down(err)
+		}
+		return nil, err
+	}
+	c.rc.up()
+	return resp, nil
+}
+
+// dial is the dial function of connect.
+func (c *clientUDP) dial(ctx context.Context) (net.Conn, error) {
+	return net.DialUDP("udp", nil, c.udpAddr)
+}
+
+// unlock unlocks remote password of the new connection before it is used by the requests.
+// the password is checked by the connected module, so the unlock is addressed to the local station. c.mu must be held.
+func (c *clientUDP) unlock(ctx context.Context) error {
+	if c.password == "" {
+		return nil
+	}
+	resp, err := c.exchange(ctx, NewLocalStation(), c.stn.appendPasswordCommand(nil, c.code, UNLOCK_COMMAND, c.password), c.code.fieldSize(11))
+	if err == nil {
+		_, err = c.checkResponse(resp)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unlock remote password: %w", err)
+	}
+	return nil
+}
+
+// errNoResponse is returned when no response is received after all the retries.
+var errNoResponse = errors.New("no response from plc")
+
+// exchange sends the command as one datagram and waits for the response of respSize like roundTrip.
+// the request is sent up to 1 + retries times until ctx is done. c.mu must be held.
+func (c *clientUDP) exchange(ctx context.Context, stn *station, command []byte, respSize int64) ([]byte, error) {
+	if c.datagram == nil {
+		c.datagram = make([]byte, 2*13+MAX_RESPONSE_DATA_LEN) // the largest header is ascii 4E frame
+	}
+	buff := c.datagram
+	first := c.serial
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		serial := c.serial
+		c.serial++
+		if c.is4E {
+			c.frameBuff = stn.appendFrame4E(c.frameBuff[:0], c.code, serial, command)
+		} else {
+			c.frameBuff = stn.appendFrame3E(c.frameBuff[:0], c.code, command)
+			c.discardStale(buff)
+		}
+
+		if _, err := c.conn.Write(c.frameBuff); err != nil {
+			return nil, err
+		}
+
+		deadline := time.Now().Add(c.timeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		resp, err := c.receive(ctx, buff, deadline, respSize, first, serial)
+		if err != nil {
+			return nil, &noResponseError{err}
+		}
+		if resp != nil {
+			return resp, nil
+		}
+	}
+	return nil, &noResponseError{fmt.Errorf("%w after %v attempts", errNoResponse, c.retries+1)}
+}
+
+// receive reads the datagrams until the response is received or the deadline.
+// nil response without error means timeout, ctx error is returned when ctx is done.
+func (c *clientUDP) receive(ctx context.Context, buff []byte, deadline time.Time, respSize int64, first, last uint16) ([]byte, error) {
+	c.watcher.start(ctx, c.conn, readDeadline, deadline)
+	defer c.watcher.stop()
+	for {
+		n, err := c.conn.Read(buff)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil, contextErr(ctx, nil)
+			}
+			return nil, err
+		}
+		if resp, ok := c.match(buff[:n], respSize, first, last); ok {
+			return resp, nil
+		}
+	}
+}
+
+// match reports whether the datagram is one complete response frame of the request
+// which serial number is first to last. the response of normal end must be respSize like roundTrip,
+// so a late response of the other request is not returned as the response of 3E frame.
+func (c *clientUDP) match(datagram []byte, respSize int64, first, last uint16) ([]byte, bool) {
+	r := bytes.NewReader(datagram)
+	resp, err := readFrame(r, c.code, c.is4E)
+	if err != nil || r.Len() != 0 {
+		return nil, false
+	}
+
+	f, err := parseFrame(c.code, resp)
+	if err != nil {
+		return nil, false
+	}
+	if c.is4E {
+		if f.serial-first > last-first {
+			return nil, false
+		}
+		respSize += c.code.fieldSize(4) // serial number + 0000
+	}
+	if f.endCode == 0 && int64(len(resp)) != respSize {
+		return nil, false
+	}
+	return resp, true
+}
+
+// discardStale reads and discards the datagrams already received, e.g. late response of the timed out request.
+func (c *clientUDP) discardStale(buff []byte) {
+	for {
+		if err := c.conn.SetReadDeadline(time.Now()); err != nil {
+			return
+		}
+		if _, err := c.conn.Read(buff); err != nil {
+			return
+		}
+	}
+}
+
+func (c *clientUDP) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rc.closed()
+	c.watcher.close()
+	if c.conn != nil {
+		err := c.conn.Close()
+		c.conn = nil
+		return err
+	}
+	return nil
+}
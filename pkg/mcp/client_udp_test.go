@@ -0,0 +1,129 @@
+package mcp
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// servePLCUDP starts UDP server which answers the requests in order with the datagrams returned by each handler.
+func servePLCUDP(t *testing.T, handlers ...func(req []byte) [][]byte) (string, int) {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buff := make([]byte, 1024)
+		for _, handler := range handlers {
+			n, addr, err := conn.ReadFromUDP(buff)
+			if err != nil {
+				return
+			}
+			for _, resp := range handler(buff[:n]) {
+				if _, err := conn.WriteToUDP(resp, addr); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	addr := conn.LocalAddr().(*net.UDPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func TestClient3EUDP_Retry(t *testing.T) {
+	read, _ := hex.DecodeString("d00000ffff0300040000000100")
+	host, port := servePLCUDP(t,
+		func(req []byte) [][]byte { return nil }, // first datagram is lost
+		func(req []byte) [][]byte { return [][]byte{read} },
+	)
+
+	client, err := New3EUDPClient(host, port, NewLocalStation(), WithTimeout(50*time.Millisecond), WithRetries(1))
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	resp, err := client.Read("D", 100, 1)
+	if err != nil {
+		t.Fatalf("unexpected mcp read err: %v", err)
+	}
+	if hex.EncodeToString(resp) != hex.EncodeToString(read) {
+		t.Fatalf("expected %x but actual is %x", read, resp)
+	}
+
+	// no response after the retries
+	if _, err := client.Read("D", 100, 1); !errors.Is(err, errNoResponse) {
+		t.Fatalf("expected %v but actual is %v", errNoResponse, err)
+	}
+}
+
+func TestClient4EUDP_DiscardMismatched(t *testing.T) {
+	host, port := servePLCUDP(t,
+		func(req []byte) [][]byte {
+			serial := req[2:4]
+			stale, _ := hex.DecodeString("d400" + hex.EncodeToString([]byte{serial[0] + 1, serial[1]}) + "0000" + "00ffff0300" + "0400" + "0000" + "ffff")
+			broken, _ := hex.DecodeString("d400" + hex.EncodeToString(serial) + "0000" + "00ffff0300" + "0400")
+			resp, _ := hex.DecodeString("d400" + hex.EncodeToString(serial) + "0000" + "00ffff0300" + "0400" + "0000" + "0100")
+			return [][]byte{stale, broken, resp}
+		},
+	)
+
+	client, err := New4EUDPClient(host, port, NewLocalStation(), WithTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	resp, err := client.Read("D", 100, 1)
+	if err != nil {
+		t.Fatalf("unexpected mcp read err: %v", err)
+	}
+	response, err := NewParser().Do(resp)
+	if err != nil {
+		t.Fatalf("unexpected parser err: %v", err)
+	}
+	if hex.EncodeToString(response.Payload) != "0100" {
+		t.Fatalf("expected %v but actual is %x", "0100", response.Payload)
+	}
+}
+
+func TestClient3EUDP_DiscardLate(t *testing.T) {
+	late, _ := hex.DecodeString("d00000ffff0300060000003412cdab")
+	read, _ := hex.DecodeString("d00000ffff0300040000000100")
+	host, port := servePLCUDP(t,
+		// the response of the first request is late, it is received after the next request is sent
+		func(req []byte) [][]byte {
+			time.Sleep(100 * time.Millisecond)
+			return [][]byte{late}
+		},
+		func(req []byte) [][]byte { return [][]byte{read} },
+	)
+
+	client, err := New3EUDPClient(host, port, NewLocalStation(), WithTimeout(time.Second), WithRetries(0))
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.ReadContext(ctx, "D", 100, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded but actual is %v", err)
+	}
+
+	// the late response of 2 points is not the response of 1 point
+	resp, err := client.Read("D", 100, 1)
+	if err != nil {
+		t.Fatalf("unexpected mcp read err: %v", err)
+	}
+	if hex.EncodeToString(resp) != hex.EncodeToString(read) {
+		t.Fatalf("expected %x but actual is %x", read, resp)
+	}
+}
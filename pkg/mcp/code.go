@@ -1,9 +1,9 @@
 package mcp
 
 import (
-	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"fmt"
 )
 
 // PLC Data communication code.
@@ -30,7 +30,195 @@ func (c Code) EncodeHex(s string) ([]byte, error) {
 		return nil, err
 	}
 
-	buff := new(bytes.Buffer)
-	_ = binary.Write(buff, binary.LittleEndian, decode)
-	return buff.Bytes(), nil
+	// reverse to lower byte first
+	for i, j := 0, len(decode)-1; i < j; i, j = i+1, j-1 {
+		decode[i], decode[j] = decode[j], decode[i]
+	}
+	return decode, nil
+}
+
+// string returns the bytes on the wire as the hex string of the code like the Build*Request of station.
+// Binary is upper case hex expression of the bytes, Ascii is the bytes themselves.
+func (c Code) string(b []byte) string {
+	if c == Ascii {
+		return string(b)
+	}
+	s := make([]byte, 0, 2*len(b))
+	for _, v := range b {
+		s = appendHexByte(s, v)
+	}
+	return string(s)
+}
+
+// hexDigits is upper case hex digits of ascii code.
+const hexDigits = "0123456789ABCDEF"
+
+// appendHexByte appends b as 2 upper case hex characters.
+func appendHexByte(dst []byte, b byte) []byte {
+	return append(dst, hexDigits[b>>4], hexDigits[b&0x0F])
+}
+
+// appendUint appends v as n byte field of the code expression to dst.
+// Binary is lower byte first, Ascii is hex characters from upper byte.
+func (c Code) appendUint(dst []byte, v int64, n int) []byte {
+	if c == Binary {
+		for i := 0; i < n; i++ {
+			dst = append(dst, byte(v>>(8*uint(i))))
+		}
+		return dst
+	}
+	for i := n - 1; i >= 0; i-- {
+		dst = appendHexByte(dst, byte(v>>(8*uint(i))))
+	}
+	return dst
+}
+
+// appendHex appends hex string of binary mode expression (like command "0104") to dst in the code expression.
+// Binary appends the decoded bytes, Ascii swaps byte order (like "0401").
+// binaryHex is the constant of this package or the station field, invalid hex digit is appended as 0.
+func (c Code) appendHex(dst []byte, binaryHex string) []byte {
+	if c == Binary {
+		for i := 0; i+1 < len(binaryHex); i += 2 {
+			dst = append(dst, unhex(binaryHex[i])<<4|unhex(binaryHex[i+1]))
+		}
+		return dst
+	}
+	for i := len(binaryHex); i >= 2; i -= 2 {
+		dst = append(dst, binaryHex[i-2:i]...)
+	}
+	return dst
+}
+
+// appendWords appends little endian word data to dst in the code expression.
+func (c Code) appendWords(dst []byte, data []byte) []byte {
+	if c == Binary {
+		return append(dst, data...)
+	}
+	for i := 0; i+1 < len(data); i += 2 {
+		dst = appendHexByte(dst, data[i+1])
+		dst = appendHexByte(dst, data[i])
+	}
+	return dst
+}
+
+// unhex returns the value of the hex digit. invalid digit is 0.
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return 0
+}
+
+// parseHex parses ascii hex characters (like "00FF") as unsigned integer without allocation.
+// ok is false if b has the character which is not hex digit.
+func parseHex(b []byte) (v uint64, ok bool) {
+	for _, c := range b {
+		d := unhex(c)
+		if d == 0 && c != '0' {
+			return 0, false
+		}
+		v = v<<4 | uint64(d)
+	}
+	return v, true
+}
+
+// fieldSize returns byte size on the wire of n byte field of binary mode expression.
+// ascii is twice the size (1byte=2char).
+func (c Code) fieldSize(n int) int64 {
+	if c == Ascii {
+		return int64(2 * n)
+	}
+	return int64(n)
+}
+
+// bitDataSize returns size on the wire of numPoints bit data. binary packs two points into one byte,
+// ascii is one character per point.
+func (c Code) bitDataSize(numPoints int64) int64 {
+	if c == Ascii {
+		return numPoints
+	}
+	return (numPoints + 1) / 2
+}
+
+// hexUint returns v as n byte field of binary mode expression like "FF03" of the station fields.
+func hexUint(v int64, n int) string {
+	var b [8]byte
+	return Binary.string(Binary.appendUint(b[:0], v, n))
+}
+
+// appendHexBytes appends the bytes of ascii hex characters (like "5B10") to dst.
+// ok is false if src has the character which is not hex digit or odd length.
+func appendHexBytes(dst []byte, src []byte) ([]byte, bool) {
+	if len(src)%2 != 0 {
+		return dst, false
+	}
+	for i := 0; i < len(src); i += 2 {
+		v, ok := parseHex(src[i : i+2])
+		if !ok {
+			return dst, false
+		}
+		dst = append(dst, byte(v))
+	}
+	return dst, true
+}
+
+// decodeWords converts response word data to little endian binary layout.
+func (c Code) decodeWords(data []byte) ([]byte, error) {
+	if c == Binary {
+		return data, nil
+	}
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("ascii word data length must be multiple of 4 but %v", len(data))
+	}
+	words := make([]byte, len(data)/2)
+	for i := 0; i < len(data); i += 4 {
+		word, ok := parseHex(data[i : i+4])
+		if !ok {
+			return nil, fmt.Errorf("invalid ascii word data [%s]", data[i:i+4])
+		}
+		binary.LittleEndian.PutUint16(words[i/2:], uint16(word))
+	}
+	return words, nil
+}
+
+// decodeDWords converts response double word data to little endian binary layout.
+func (c Code) decodeDWords(data []byte) ([]byte, error) {
+	if c == Binary {
+		return data, nil
+	}
+	if len(data)%8 != 0 {
+		return nil, fmt.Errorf("ascii double word data length must be multiple of 8 but %v", len(data))
+	}
+	dwords := make([]byte, len(data)/2)
+	for i := 0; i < len(data); i += 8 {
+		dword, ok := parseHex(data[i : i+8])
+		if !ok {
+			return nil, fmt.Errorf("invalid ascii double word data [%s]", data[i:i+8])
+		}
+		binary.LittleEndian.PutUint32(dwords[i/2:], uint32(dword))
+	}
+	return dwords, nil
+}
+
+// decodeBits converts response bit data to binary layout. two points are packed into one byte,
+// upper 4 bit is the first point.
+func (c Code) decodeBits(data []byte) ([]byte, error) {
+	if c == Binary {
+		return data, nil
+	}
+	bits := make([]byte, (len(data)+1)/2)
+	for i, b := range data {
+		if b != '0' && b != '1' {
+			return nil, fmt.Errorf("invalid ascii bit data [%s]", data)
+		}
+		if b == '1' {
+			bits[i/2] |= 0x10 >> (4 * uint(i%2))
+		}
+	}
+	return bits, nil
 }
@@ -0,0 +1,64 @@
+package mcp
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// CPUModel is model name and model code of the CPU.
+type CPUModel struct {
+	// model name like "Q03UDVCPU", "R04CPU".
+	Name string
+	// model code like 0366h (Q03UDVCPU), 4800h (R04CPU).
+	Code uint16
+}
+
+// Series returns PLC series for the device addressing of the CPU model.
+// MELSEC iQ-R model name starts with "R", others are MELSEC-Q/L compatible addressing.
+func (m CPUModel) Series() Series {
+	if strings.HasPrefix(m.Name, "R") {
+		return IQRSeries
+	}
+	return QLSeries
+}
+
+func (m CPUModel) String() string {
+	return fmt.Sprintf("%s (%04X)", m.Name, m.Code)
+}
+
+// ReadCPUModel is send read CPU model name command to remote plc.
+func (c *baseClient) ReadCPUModel() (CPUModel, error) {
+	return c.ReadCPUModelContext(context.Background())
+}
+
+// ReadCPUModelContext is ReadCPUModel with the context. the request is canceled when ctx is done.
+func (c *baseClient) ReadCPUModelContext(ctx context.Context) (CPUModel, error) {
+	command := c.stn.appendCPUModelCommand(nil, c.code)
+
+	// response data is model name[16byte] + model code[2byte]
+	resp, err := c.request(ctx, command, 16+c.code.fieldSize(2), func(data []byte) ([]byte, error) {
+		if len(data) != 16+4 {
+			return nil, fmt.Errorf("cpu model data length must be %v but %v", 16+4, len(data))
+		}
+		// model name is ascii characters on both code.
+		modelCode, err := c.code.decodeWords(data[16:])
+		return append(append([]byte{}, data[:16]...), modelCode...), err
+	})
+	if err != nil {
+		return CPUModel{}, err
+	}
+
+	payload, err := NewParser().Payload(resp)
+	if err != nil {
+		return CPUModel{}, err
+	}
+	if len(payload) != 16+2 {
+		return CPUModel{}, fmt.Errorf("cpu model data length must be %v but %v", 16+2, len(payload))
+	}
+	return CPUModel{
+		Name: strings.TrimRight(string(payload[:16]), " \x00"),
+		Code: binary.LittleEndian.Uint16(payload[16:]),
+	}, nil
+}
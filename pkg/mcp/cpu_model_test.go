@@ -0,0 +1,64 @@
+package mcp
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClient3E_ReadCPUModel(t *testing.T) {
+	cases := []struct {
+		code     Code
+		resp     string
+		expected CPUModel
+		series   Series
+	}{
+		{
+			code:     Binary,
+			resp:     "d000 00 ff ff03 00 1400 0000 " + hex.EncodeToString([]byte("R04CPU          ")) + "0048",
+			expected: CPUModel{Name: "R04CPU", Code: 0x4800},
+			series:   IQRSeries,
+		},
+		{
+			code:     Ascii,
+			resp:     hex.EncodeToString([]byte("D00000FF03FF0000180000Q03UDVCPU       0366")),
+			expected: CPUModel{Name: "Q03UDVCPU", Code: 0x0366},
+			series:   QLSeries,
+		},
+	}
+
+	for _, v := range cases {
+		host, port := servePLC(t, v.resp)
+		client, err := New3EClient(host, port, NewLocalStation(), WithCode(v.code))
+		if err != nil {
+			t.Fatalf("unexpected client err: %v", err)
+		}
+
+		model, err := client.ReadCPUModel()
+		client.Close()
+		if err != nil {
+			t.Fatalf("unexpected read cpu model err: %v", err)
+		}
+		if model != v.expected || model.Series() != v.series {
+			t.Errorf("expected %v but actual is %v", v.expected, model)
+		}
+	}
+}
+
+func TestClient3E_ReadCPUModelContext(t *testing.T) {
+	// plc does not respond and keeps the connection open
+	host, port := servePLC(t, "", "")
+	client, err := New3EClient(host, port, NewLocalStation())
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.ReadCPUModelContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded but actual is %v", err)
+	}
+}
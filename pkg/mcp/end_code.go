@@ -0,0 +1,130 @@
+package mcp
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+// endCodeDescriptions is the catalog of the end codes returned by the ethernet module and the CPU.
+var endCodeDescriptions = map[uint16]string{
+	0xC050: "ascii data that can not be converted to binary is received",
+	0xC051: "number of read/write points is out of range",
+	0xC052: "number of read/write points is out of range",
+	0xC053: "number of read/write points is out of range",
+	0xC054: "number of read/write points is out of range",
+	0xC055: "number of file data read/write points is out of range",
+	0xC056: "read/write request exceeds the maximum address",
+	0xC058: "request data length after ascii to binary conversion does not match",
+	0xC059: "command or subcommand is not supported",
+	0xC05B: "the CPU can not read/write the specified device",
+	0xC05C: "request content is wrong (e.g. bit device is accessed in word units)",
+	0xC05D: "monitor registration is not performed",
+	0xC05F: "request can not be executed to the target CPU",
+	0xC060: "request content is wrong (e.g. bit device data)",
+	0xC061: "request data length does not match the number of data",
+	0xC06F: "data communication code of the request does not match the setting (ascii/binary)",
+	0xC070: "device memory extension can not be specified for the target station",
+	0xC072: "request content is wrong (e.g. buffer memory address of the module)",
+	0xC074: "request can not be executed to the target station",
+	0xC0B5: "the CPU can not handle the specified data",
+	0xC200: "remote password is wrong",
+	0xC201: "communication port is locked by remote password",
+	0xC204: "remote password is unlocked by the other device",
+	0xCEE0: "monitor request is sent from the other device",
+	0xCEE1: "request size is over the limit",
+	0xCEE2: "response size is over the limit",
+}
+
+// endCodeDescriptions1E is the catalog of the end codes of 1E frame.
+var endCodeDescriptions1E = map[uint16]string{
+	0x50: "command or response type of the sub header is wrong",
+	0x54: "ascii data that can not be converted to binary is received",
+	0x55: "the CPU can not write the device while running",
+	0x56: "device is wrong",
+	0x57: "number of read/write points is out of range",
+	0x58: "head device is out of range",
+	0x5B: "the CPU and the module can not communicate (see the abnormal code)",
+}
+
+// EndCodeError is the error of the response which end code is not 0000.
+// the station fields and the command are from error information of the response.
+// 1E response has only the end code and the abnormal code.
+type EndCodeError struct {
+	// end code like C051, 1E end code is 1 byte like 5B
+	EndCode uint16
+	// abnormal code of 1E response which end code is 5B
+	AbnormalCode uint8
+	// network number of the responding station
+	NetworkNum uint8
+	// PC number of the responding station
+	PCNum uint8
+	// request destination module I/O number of the responding station
+	UnitIONum uint16
+	// request destination module station number of the responding station
+	UnitStationNum uint8
+	// command of the request
+	Command uint16
+	// sub command of the request
+	SubCommand uint16
+
+	// is1E is true if the error is of 1E response.
+	is1E bool
+}
+
+// Description returns the description of the end code from the catalog.
+func (e *EndCodeError) Description() string {
+	if e.is1E {
+		if desc, ok := endCodeDescriptions1E[e.EndCode]; ok {
+			return desc
+		}
+		return "unknown error"
+	}
+	if desc, ok := endCodeDescriptions[e.EndCode]; ok {
+		return desc
+	}
+	if e.EndCode >= 0x4000 && e.EndCode <= 0x4FFF {
+		return "error detected by the CPU (see the CPU error code)"
+	}
+	return "unknown error"
+}
+
+func (e *EndCodeError) Error() string {
+	if e.is1E {
+		return fmt.Sprintf("plc returned end code [%02X] %s: abnormal code %02X", e.EndCode, e.Description(), e.AbnormalCode)
+	}
+	return fmt.Sprintf("plc returned end code [%04X] %s: network %02X station %02X unit %04X-%02X command %04X sub command %04X",
+		e.EndCode, e.Description(), e.NetworkNum, e.PCNum, e.UnitIONum, e.UnitStationNum, e.Command, e.SubCommand)
+}
+
+// Err returns *EndCodeError if end code of the 3E or 4E response is not 0000, or 1E response is not 00.
+func (r *Response) Err() error {
+	if r.EndCode == "0000" || r.EndCode == "00" {
+		return nil
+	}
+	endCode, err := hex.DecodeString(r.EndCode)
+	if err != nil || (len(endCode) != 1 && len(endCode) != 2) {
+		return fmt.Errorf("invalid end code [%s]", r.EndCode)
+	}
+	if len(endCode) == 1 {
+		f := frame1E{endCode: endCode[0], errInfo: r.ErrInfo}
+		return f.err()
+	}
+
+	return newEndCodeError(binary.LittleEndian.Uint16(endCode), r.ErrInfo)
+}
+
+// newEndCodeError returns the error of the end code and binary layout of the error information.
+func newEndCodeError(endCode uint16, info []byte) *EndCodeError {
+	e := &EndCodeError{EndCode: endCode}
+	// error information is network num + PC num + unit I/O num + unit station num + command + sub command
+	if len(info) >= 9 {
+		e.NetworkNum = info[0]
+		e.PCNum = info[1]
+		e.UnitIONum = binary.LittleEndian.Uint16(info[2:4])
+		e.UnitStationNum = info[4]
+		e.Command = binary.LittleEndian.Uint16(info[5:7])
+		e.SubCommand = binary.LittleEndian.Uint16(info[7:9])
+	}
+	return e
+}
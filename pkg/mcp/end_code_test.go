@@ -0,0 +1,115 @@
+package mcp
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestResponse_Err(t *testing.T) {
+	expected := EndCodeError{
+		EndCode:        0xC051,
+		NetworkNum:     0x00,
+		PCNum:          0xFF,
+		UnitIONum:      0x03FF,
+		UnitStationNum: 0x00,
+		Command:        0x0401,
+		SubCommand:     0x0000,
+	}
+
+	binaryResp, _ := hex.DecodeString("d00000ffff03000b0051c000ffff0300010400" + "00")
+	asciiResp := []byte("D000" + "00" + "FF" + "03FF" + "00" + "0016" + "C051" + "00FF03FF00" + "0401" + "0000")
+
+	for _, v := range []struct {
+		code Code
+		resp []byte
+	}{
+		{code: Binary, resp: binaryResp},
+		{code: Ascii, resp: asciiResp},
+	} {
+		response, err := NewParserWithCode(v.code).Do(v.resp)
+		if err != nil {
+			t.Fatalf("unexpected parse err: %v", err)
+		}
+		if response.Payload != nil {
+			t.Errorf("expected nil payload but actual is %X", response.Payload)
+		}
+
+		var endCodeErr *EndCodeError
+		if err := response.Err(); !errors.As(err, &endCodeErr) {
+			t.Fatalf("expected EndCodeError but actual is %v", err)
+		}
+		if *endCodeErr != expected {
+			t.Errorf("expected %+v but actual is %+v", expected, *endCodeErr)
+		}
+		if !strings.Contains(endCodeErr.Error(), "[C051] number of read/write points is out of range") {
+			t.Errorf("unexpected error message: %v", endCodeErr)
+		}
+	}
+}
+
+func TestResponse_Err1E(t *testing.T) {
+	binaryResp, _ := hex.DecodeString("815b10")
+	for _, v := range []struct {
+		code Code
+		resp []byte
+	}{
+		{code: Binary, resp: binaryResp},
+		{code: Ascii, resp: []byte("815B10")},
+	} {
+		response, err := NewParserWithCode(v.code).Do(v.resp)
+		if err != nil {
+			t.Fatalf("unexpected parse err: %v", err)
+		}
+
+		var endCodeErr *EndCodeError
+		if err := response.Err(); !errors.As(err, &endCodeErr) {
+			t.Fatalf("expected EndCodeError but actual is %v", err)
+		}
+		if endCodeErr.EndCode != 0x5B || endCodeErr.AbnormalCode != 0x10 {
+			t.Errorf("unexpected end code error %+v", *endCodeErr)
+		}
+		if !strings.Contains(endCodeErr.Error(), "[5B] the CPU and the module can not communicate (see the abnormal code): abnormal code 10") {
+			t.Errorf("unexpected error message: %v", endCodeErr)
+		}
+	}
+}
+
+func TestEndCodeError_Description(t *testing.T) {
+	cases := []struct {
+		endCode  uint16
+		expected string
+	}{
+		{endCode: 0xC059, expected: "command or subcommand is not supported"},
+		{endCode: 0x4031, expected: "error detected by the CPU (see the CPU error code)"},
+		{endCode: 0xC0FF, expected: "unknown error"},
+	}
+	for _, v := range cases {
+		e := &EndCodeError{EndCode: v.endCode}
+		if e.Description() != v.expected {
+			t.Errorf("expected %v but actual is %v", v.expected, e.Description())
+		}
+	}
+}
+
+func TestClient3E_EndCodeError(t *testing.T) {
+	host, port := servePLC(t,
+		"d000 00 ff ff03 00 0b00 59c0 00ff ff03 00 0104 0000",
+	)
+
+	client, err := New3EClient(host, port, NewLocalStation())
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	_, err = client.Read("D", 0, 1)
+	var endCodeErr *EndCodeError
+	if !errors.As(err, &endCodeErr) {
+		t.Fatalf("expected EndCodeError but actual is %v", err)
+	}
+	if endCodeErr.EndCode != 0xC059 || endCodeErr.Command != 0x0401 {
+		t.Fatalf("unexpected end code error: %+v", endCodeErr)
+	}
+}
@@ -0,0 +1,493 @@
+package mcptest
+
+import (
+	"fmt"
+)
+
+const (
+	commandRead             = 0x0401
+	commandWrite            = 0x1401
+	commandRandomRead       = 0x0403
+	commandRandomWrite      = 0x1402
+	commandBlockRead        = 0x0406
+	commandBlockWrite       = 0x1406
+	commandMonitorRegister  = 0x0801
+	commandMonitor          = 0x0802
+	commandLoopback         = 0x0619
+	commandCPUModel         = 0x0101
+	commandRemoteRun        = 0x1001
+	commandRemoteStop       = 0x1002
+	commandRemotePause      = 0x1003
+	commandRemoteLatchClear = 0x1005
+	commandRemoteReset      = 0x1006
+	commandUnlock           = 0x1630
+	commandLock             = 0x1631
+
+	// sub command bits of device access
+	subCommandBit = 0x0001
+	subCommandIQR = 0x0002
+)
+
+// end codes of the simulated errors
+const (
+	EndCodePoints      = 0xC051 // number of read/write points is out of range
+	EndCodeUnsupported = 0xC059 // command or subcommand is not supported
+	EndCodeDevice      = 0xC05B // the CPU can not read/write the specified device
+	EndCodeContent     = 0xC05C // request content is wrong
+	EndCodeNoMonitor   = 0xC05D // monitor registration is not performed
+	EndCodeDataLength  = 0xC061 // request data length does not match the number of data
+	EndCodePassword    = 0xC200 // remote password is wrong
+	EndCodeLocked      = 0xC201 // communication port is locked by remote password
+)
+
+const (
+	maxWordPoints   = 960
+	maxBitPoints    = 7168
+	maxRandomPoints = 192
+)
+
+// endCodeError is the abnormal end of the request.
+type endCodeError uint16
+
+func (e endCodeError) Error() string {
+	return fmt.Sprintf("end code %04X", uint16(e))
+}
+
+// dataReader reads the fields of the request data.
+type dataReader struct {
+	data []byte
+	iqr  bool
+}
+
+// uint reads n byte little endian value.
+func (r *dataReader) uint(n int) (int, error) {
+	if len(r.data) < n {
+		return 0, endCodeError(EndCodeDataLength)
+	}
+	v := 0
+	for i := n - 1; i >= 0; i-- {
+		v = v<<8 | int(r.data[i])
+	}
+	r.data = r.data[n:]
+	return v, nil
+}
+
+// bytes reads n bytes.
+func (r *dataReader) bytes(n int) ([]byte, error) {
+	if len(r.data) < n {
+		return nil, endCodeError(EndCodeDataLength)
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b, nil
+}
+
+// device reads device number and device code. MELSEC-Q/L is 3byte + 1byte, MELSEC iQ-R is 4byte + 2byte.
+func (r *dataReader) device() (deviceInfo, int, error) {
+	numberSize, codeSize := 3, 1
+	if r.iqr {
+		numberSize, codeSize = 4, 2
+	}
+	offset, err := r.uint(numberSize)
+	if err != nil {
+		return deviceInfo{}, 0, err
+	}
+	code, err := r.uint(codeSize)
+	if err != nil {
+		return deviceInfo{}, 0, err
+	}
+	dev, ok := deviceByCode(uint16(code))
+	if !ok {
+		return deviceInfo{}, 0, endCodeError(EndCodeDevice)
+	}
+	return dev, offset, nil
+}
+
+// end checks all the request data is read.
+func (r *dataReader) end() error {
+	if len(r.data) != 0 {
+		return endCodeError(EndCodeDataLength)
+	}
+	return nil
+}
+
+// appendUint appends n byte little endian value.
+func appendUint(b []byte, v, n int) []byte {
+	for i := 0; i < n; i++ {
+		b = append(b, byte(v>>(8*uint(i))))
+	}
+	return b
+}
+
+// execute executes the command of the request and returns end code and response data.
+func (s *Server) execute(sess *session, req *request) (uint16, []byte) {
+	s.mu.Lock()
+	password := s.password
+	s.mu.Unlock()
+	if password != "" && !sess.unlocked && req.command != commandUnlock && req.command != commandLock {
+		return EndCodeLocked, nil
+	}
+
+	data, err := s.command(sess, req)
+	if err != nil {
+		if e, ok := err.(endCodeError); ok {
+			return uint16(e), nil
+		}
+		return EndCodeContent, nil
+	}
+	return 0, data
+}
+
+func (s *Server) command(sess *session, req *request) ([]byte, error) {
+	r := &dataReader{data: req.data, iqr: req.subCommand&subCommandIQR != 0}
+	bit := req.subCommand&subCommandBit != 0
+
+	switch req.command {
+	case commandRead:
+		return s.read(r, bit)
+	case commandWrite:
+		return nil, s.write(r, bit)
+	case commandRandomRead:
+		return s.randomRead(r)
+	case commandRandomWrite:
+		return nil, s.randomWrite(r, bit)
+	case commandBlockRead:
+		return s.blockRead(r)
+	case commandBlockWrite:
+		return nil, s.blockWrite(r)
+	case commandMonitorRegister:
+		// devices are checked by the random read
+		if _, err := s.randomRead(&dataReader{data: req.data, iqr: r.iqr}); err != nil {
+			return nil, err
+		}
+		sess.monitor = append([]byte{}, req.data...)
+		sess.monitorIQR = r.iqr
+		return nil, nil
+	case commandMonitor:
+		if sess.monitor == nil {
+			return nil, endCodeError(EndCodeNoMonitor)
+		}
+		return s.randomRead(&dataReader{data: sess.monitor, iqr: sess.monitorIQR})
+	case commandLoopback:
+		n, err := r.uint(2)
+		if err != nil {
+			return nil, err
+		}
+		loopback, err := r.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		return append(appendUint(nil, n, 2), loopback...), r.end()
+	case commandCPUModel:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return appendUint([]byte(fmt.Sprintf("%-16s", s.modelName)), int(s.modelCode), 2), nil
+	case commandRemoteRun, commandRemoteStop, commandRemotePause, commandRemoteLatchClear, commandRemoteReset:
+		return nil, nil
+	case commandUnlock, commandLock:
+		n, err := r.uint(2)
+		if err != nil {
+			return nil, err
+		}
+		password, err := r.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if string(password) != s.password {
+			return nil, endCodeError(EndCodePassword)
+		}
+		sess.unlocked = req.command == commandUnlock
+		return nil, nil
+	}
+	return nil, endCodeError(EndCodeUnsupported)
+}
+
+// read is batch read in word units or bit units.
+func (s *Server) read(r *dataReader, bit bool) ([]byte, error) {
+	dev, offset, err := r.device()
+	if err != nil {
+		return nil, err
+	}
+	points, err := r.uint(2)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.end(); err != nil {
+		return nil, err
+	}
+
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	if !bit {
+		if points < 1 || points > maxWordPoints {
+			return nil, endCodeError(EndCodePoints)
+		}
+		var data []byte
+		for i := 0; i < points; i++ {
+			data = appendUint(data, int(s.mem.word(dev, offset+i)), 2)
+		}
+		return data, nil
+	}
+
+	if !dev.bit {
+		return nil, endCodeError(EndCodeDevice)
+	}
+	if points < 1 || points > maxBitPoints {
+		return nil, endCodeError(EndCodePoints)
+	}
+	// two points are packed into one byte, first point is upper 4 bits.
+	data := make([]byte, (points+1)/2)
+	for i := 0; i < points; i++ {
+		if s.mem.bit(dev, offset+i) {
+			data[i/2] |= 0x10 >> (4 * uint(i%2))
+		}
+	}
+	return data, nil
+}
+
+// write is batch write in word units or bit units.
+func (s *Server) write(r *dataReader, bit bool) error {
+	dev, offset, err := r.device()
+	if err != nil {
+		return err
+	}
+	points, err := r.uint(2)
+	if err != nil {
+		return err
+	}
+
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	if !bit {
+		if points < 1 || points > maxWordPoints {
+			return endCodeError(EndCodePoints)
+		}
+		if len(r.data) != 2*points {
+			return endCodeError(EndCodeDataLength)
+		}
+		for i := 0; i < points; i++ {
+			w, _ := r.uint(2)
+			s.mem.setWord(dev, offset+i, uint16(w))
+		}
+		return nil
+	}
+
+	if !dev.bit {
+		return endCodeError(EndCodeDevice)
+	}
+	if points < 1 || points > maxBitPoints {
+		return endCodeError(EndCodePoints)
+	}
+	if len(r.data) != (points+1)/2 {
+		return endCodeError(EndCodeDataLength)
+	}
+	for i := 0; i < points; i++ {
+		s.mem.setBit(dev, offset+i, r.data[i/2]&(0x10>>(4*uint(i%2))) != 0)
+	}
+	return nil
+}
+
+// randomRead is random read of word and double word devices. double word is the word of the device
+// and the next device.
+func (s *Server) randomRead(r *dataReader) ([]byte, error) {
+	numWords, err := r.uint(1)
+	if err != nil {
+		return nil, err
+	}
+	numDWords, err := r.uint(1)
+	if err != nil {
+		return nil, err
+	}
+	if numWords+numDWords < 1 || numWords+numDWords > maxRandomPoints {
+		return nil, endCodeError(EndCodePoints)
+	}
+
+	type point struct {
+		dev    deviceInfo
+		offset int
+	}
+	points := make([]point, numWords+numDWords)
+	for i := range points {
+		if points[i].dev, points[i].offset, err = r.device(); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.end(); err != nil {
+		return nil, err
+	}
+
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	var data []byte
+	for i, p := range points {
+		data = appendUint(data, int(s.mem.word(p.dev, p.offset)), 2)
+		if i >= numWords {
+			data = appendUint(data, int(s.mem.word(p.dev, p.offset+1)), 2)
+		}
+	}
+	return data, nil
+}
+
+// randomWrite is random write of word and double word devices, or bit devices.
+func (s *Server) randomWrite(r *dataReader, bit bool) error {
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+
+	if bit {
+		numBits, err := r.uint(1)
+		if err != nil {
+			return err
+		}
+		if numBits < 1 || numBits > maxRandomPoints {
+			return endCodeError(EndCodePoints)
+		}
+		// ON/OFF is 1byte, MELSEC iQ-R is 2byte
+		valueSize := 1
+		if r.iqr {
+			valueSize = 2
+		}
+		for i := 0; i < numBits; i++ {
+			dev, offset, err := r.device()
+			if err != nil {
+				return err
+			}
+			value, err := r.uint(valueSize)
+			if err != nil {
+				return err
+			}
+			if !dev.bit {
+				return endCodeError(EndCodeDevice)
+			}
+			s.mem.setBit(dev, offset, value != 0)
+		}
+		return r.end()
+	}
+
+	numWords, err := r.uint(1)
+	if err != nil {
+		return err
+	}
+	numDWords, err := r.uint(1)
+	if err != nil {
+		return err
+	}
+	if numWords+numDWords < 1 || numWords+numDWords > maxRandomPoints {
+		return endCodeError(EndCodePoints)
+	}
+	for i := 0; i < numWords+numDWords; i++ {
+		dev, offset, err := r.device()
+		if err != nil {
+			return err
+		}
+		size := 2
+		if i >= numWords {
+			size = 4
+		}
+		value, err := r.uint(size)
+		if err != nil {
+			return err
+		}
+		s.mem.setWord(dev, offset, uint16(value))
+		if size == 4 {
+			s.mem.setWord(dev, offset+1, uint16(value>>16))
+		}
+	}
+	return r.end()
+}
+
+// blockRead is multiple block batch read. bit device block is read in word units.
+func (s *Server) blockRead(r *dataReader) ([]byte, error) {
+	numWordBlocks, err := r.uint(1)
+	if err != nil {
+		return nil, err
+	}
+	numBitBlocks, err := r.uint(1)
+	if err != nil {
+		return nil, err
+	}
+
+	type block struct {
+		dev            deviceInfo
+		offset, points int
+	}
+	blocks := make([]block, numWordBlocks+numBitBlocks)
+	total := 0
+	for i := range blocks {
+		if blocks[i].dev, blocks[i].offset, err = r.device(); err != nil {
+			return nil, err
+		}
+		if blocks[i].points, err = r.uint(2); err != nil {
+			return nil, err
+		}
+		if i >= numWordBlocks && !blocks[i].dev.bit {
+			return nil, endCodeError(EndCodeDevice)
+		}
+		total += blocks[i].points
+	}
+	if err := r.end(); err != nil {
+		return nil, err
+	}
+	if len(blocks) < 1 || total > maxWordPoints {
+		return nil, endCodeError(EndCodePoints)
+	}
+
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	var data []byte
+	for _, b := range blocks {
+		for i := 0; i < b.points; i++ {
+			// 1 point of bit device block is 16 bits
+			offset := b.offset + i
+			if b.dev.bit {
+				offset = b.offset + 16*i
+			}
+			data = appendUint(data, int(s.mem.word(b.dev, offset)), 2)
+		}
+	}
+	return data, nil
+}
+
+// blockWrite is multiple block batch write. bit device block is written in word units.
+func (s *Server) blockWrite(r *dataReader) error {
+	numWordBlocks, err := r.uint(1)
+	if err != nil {
+		return err
+	}
+	numBitBlocks, err := r.uint(1)
+	if err != nil {
+		return err
+	}
+	if numWordBlocks+numBitBlocks < 1 {
+		return endCodeError(EndCodePoints)
+	}
+
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	for i := 0; i < numWordBlocks+numBitBlocks; i++ {
+		dev, offset, err := r.device()
+		if err != nil {
+			return err
+		}
+		points, err := r.uint(2)
+		if err != nil {
+			return err
+		}
+		if i >= numWordBlocks && !dev.bit {
+			return endCodeError(EndCodeDevice)
+		}
+		for j := 0; j < points; j++ {
+			w, err := r.uint(2)
+			if err != nil {
+				return err
+			}
+			if dev.bit {
+				s.mem.setWord(dev, offset+16*j, uint16(w))
+			} else {
+				s.mem.setWord(dev, offset+j, uint16(w))
+			}
+		}
+	}
+	return r.end()
+}
@@ -0,0 +1,44 @@
+// mcpsim runs the in-process plc of mcptest as the standalone plc, so the capture service can be run
+// without the plc. point PLC_HOST and PLC_PORT of the capture service to it.
+//
+//	PLC_PORT=5011 PLC_TRANSPORT=tcp go run ./pkg/mcp/mcptest/mcpsim
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"nk2-PLCcapture-go/pkg/config"
+	"nk2-PLCcapture-go/pkg/mcp/mcptest"
+)
+
+func main() {
+	port := config.GetEnvAsInt("PLC_PORT", 5011)
+	network := os.Getenv("PLC_TRANSPORT")
+	if network == "" {
+		network = "tcp"
+	}
+	latency := config.GetEnvAsInt("PLC_SIM_LATENCY_MS", 0)
+
+	logger := log.New(os.Stdout, "", log.LstdFlags)
+
+	plc, err := mcptest.Listen(network, fmt.Sprintf(":%d", port))
+	if err != nil {
+		logger.Fatalf("Error starting PLC simulator: %v", err)
+	}
+	plc.SetLatency(time.Duration(latency) * time.Millisecond)
+	logger.Printf("PLC simulator is listening on %s/%s", plc.Addr(), network)
+
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
+	<-signalCh
+
+	logger.Printf("PLC simulator received %d requests", plc.Requests())
+	if err := plc.Close(); err != nil {
+		logger.Printf("Error closing PLC simulator: %v", err)
+	}
+}
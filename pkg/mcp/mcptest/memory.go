@@ -0,0 +1,181 @@
+package mcptest
+
+import (
+	"fmt"
+	"sync"
+)
+
+// deviceInfo is binary device code of the device name.
+type deviceInfo struct {
+	// binary mode device code. MELSEC iQ-R 2byte device code is this code + 00h.
+	code uint16
+	// bit device like M, X. word device like D, W.
+	bit bool
+}
+
+// devices is device name and device code map. it is same as the device codes of mcp package.
+var devices = map[string]deviceInfo{
+	"SM":   {code: 0x91, bit: true},
+	"SD":   {code: 0xA9},
+	"X":    {code: 0x9C, bit: true},
+	"Y":    {code: 0x9D, bit: true},
+	"M":    {code: 0x90, bit: true},
+	"L":    {code: 0x92, bit: true},
+	"F":    {code: 0x93, bit: true},
+	"V":    {code: 0x94, bit: true},
+	"B":    {code: 0xA0, bit: true},
+	"D":    {code: 0xA8},
+	"W":    {code: 0xB4},
+	"TS":   {code: 0xC1, bit: true},
+	"TC":   {code: 0xC0, bit: true},
+	"TN":   {code: 0xC2},
+	"CS":   {code: 0xC4, bit: true},
+	"CC":   {code: 0xC3, bit: true},
+	"CN":   {code: 0xC5},
+	"SB":   {code: 0xA1, bit: true},
+	"SW":   {code: 0xB5},
+	"DX":   {code: 0xA2, bit: true},
+	"DY":   {code: 0xA3, bit: true},
+	"S":    {code: 0x98, bit: true},
+	"Z":    {code: 0xCC},
+	"R":    {code: 0xAF},
+	"ZR":   {code: 0xB0},
+	"STS":  {code: 0xC7, bit: true},
+	"STC":  {code: 0xC6, bit: true},
+	"STN":  {code: 0xC8},
+	"LTN":  {code: 0x52},
+	"LTS":  {code: 0x51, bit: true},
+	"LTC":  {code: 0x50, bit: true},
+	"LSTN": {code: 0x5A},
+	"LSTS": {code: 0x59, bit: true},
+	"LSTC": {code: 0x58, bit: true},
+	"LCN":  {code: 0x56},
+	"LCS":  {code: 0x55, bit: true},
+	"LCC":  {code: 0x54, bit: true},
+	"LZ":   {code: 0x62},
+	"RD":   {code: 0x2C},
+}
+
+// deviceByCode returns the device of the binary device code.
+func deviceByCode(code uint16) (deviceInfo, bool) {
+	for _, d := range devices {
+		if d.code == code {
+			return d, true
+		}
+	}
+	return deviceInfo{}, false
+}
+
+// memory is device memory image of the plc. all devices are 0 (OFF) at first.
+// word device is word units, bit device is bit units and its word is 16 points from the offset.
+type memory struct {
+	mu    sync.Mutex
+	words map[uint16]map[int]uint16
+	bits  map[uint16]map[int]bool
+}
+
+func newMemory() *memory {
+	return &memory{words: map[uint16]map[int]uint16{}, bits: map[uint16]map[int]bool{}}
+}
+
+// word returns the word of the device. mu must be held.
+func (m *memory) word(dev deviceInfo, offset int) uint16 {
+	if !dev.bit {
+		return m.words[dev.code][offset]
+	}
+	var w uint16
+	for i := 0; i < 16; i++ {
+		if m.bits[dev.code][offset+i] {
+			w |= 1 << uint(i)
+		}
+	}
+	return w
+}
+
+// setWord sets the word of the device. mu must be held.
+func (m *memory) setWord(dev deviceInfo, offset int, w uint16) {
+	if !dev.bit {
+		if m.words[dev.code] == nil {
+			m.words[dev.code] = map[int]uint16{}
+		}
+		m.words[dev.code][offset] = w
+		return
+	}
+	for i := 0; i < 16; i++ {
+		m.setBit(dev, offset+i, w&(1<<uint(i)) != 0)
+	}
+}
+
+// bit returns ON/OFF of the bit device. mu must be held.
+func (m *memory) bit(dev deviceInfo, offset int) bool {
+	return m.bits[dev.code][offset]
+}
+
+// setBit sets ON/OFF of the bit device. mu must be held.
+func (m *memory) setBit(dev deviceInfo, offset int, on bool) {
+	if m.bits[dev.code] == nil {
+		m.bits[dev.code] = map[int]bool{}
+	}
+	m.bits[dev.code][offset] = on
+}
+
+// lookup returns the device of the device name. it panics if the device is unknown,
+// it is the mistake of the test.
+func lookup(deviceName string) deviceInfo {
+	dev, ok := devices[deviceName]
+	if !ok {
+		panic(fmt.Sprintf("mcptest: unknown device %s", deviceName))
+	}
+	return dev
+}
+
+// SetWords sets the words of the device from offset like D100.
+// words of bit device are 16 points each from offset.
+func (s *Server) SetWords(deviceName string, offset int, values ...uint16) {
+	dev := lookup(deviceName)
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	for i, v := range values {
+		s.mem.setWord(dev, offset+i, v)
+	}
+}
+
+// Words returns n words of the device from offset.
+func (s *Server) Words(deviceName string, offset, n int) []uint16 {
+	dev := lookup(deviceName)
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	values := make([]uint16, n)
+	for i := range values {
+		values[i] = s.mem.word(dev, offset+i)
+	}
+	return values
+}
+
+// SetBits sets ON/OFF of the bit device from offset like M100.
+func (s *Server) SetBits(deviceName string, offset int, values ...bool) {
+	dev := lookup(deviceName)
+	if !dev.bit {
+		panic(fmt.Sprintf("mcptest: %s is not bit device", deviceName))
+	}
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	for i, v := range values {
+		s.mem.setBit(dev, offset+i, v)
+	}
+}
+
+// Bits returns ON/OFF of n points of the bit device from offset.
+func (s *Server) Bits(deviceName string, offset, n int) []bool {
+	dev := lookup(deviceName)
+	if !dev.bit {
+		panic(fmt.Sprintf("mcptest: %s is not bit device", deviceName))
+	}
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	values := make([]bool, n)
+	for i := range values {
+		values[i] = s.mem.bit(dev, offset+i)
+	}
+	return values
+}
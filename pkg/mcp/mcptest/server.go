@@ -0,0 +1,372 @@
+// Package mcptest provides in-process plc which speaks mc protocol 3E and 4E binary frame over TCP and UDP.
+// it holds the device memory image and answers read, write, random, block, monitor, health check and
+// CPU model commands, so the mc protocol client and the capture service can be tested without the plc.
+package mcptest
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Fault is the fault injected to the response of the next request.
+type Fault struct {
+	// EndCode is returned instead of the response. 0 is normal end.
+	EndCode uint16
+	// Drop closes the connection without the response. UDP request is not answered.
+	Drop bool
+}
+
+// Server is in-process plc of mc protocol.
+type Server struct {
+	// PLC memory
+	mem *memory
+	// Mutex to synchronize access to the fields below
+	mu sync.Mutex
+	// delay of each response
+	latency time.Duration
+	// faults injected to the next requests
+	faults []Fault
+	// remote password. the connection must be unlocked when it is set.
+	password string
+	// CPU model name and model code
+	modelName string
+	modelCode uint16
+	// number of received requests
+	requests int
+
+	// tcp listener or udp connection
+	ln   net.Listener
+	udp  net.PacketConn
+	wg   sync.WaitGroup
+	done chan struct{}
+	// Close is done only once
+	closeOnce sync.Once
+	// tcp connections to close on Close
+	conns map[net.Conn]struct{}
+	// Close is started. the connection accepted after it is closed immediately.
+	closed bool
+}
+
+// NewServer starts the plc of TCP on the free port of the loopback address.
+func NewServer() (*Server, error) {
+	return Listen("tcp", "127.0.0.1:0")
+}
+
+// NewUDPServer starts the plc of UDP on the free port of the loopback address.
+func NewUDPServer() (*Server, error) {
+	return Listen("udp", "127.0.0.1:0")
+}
+
+// Listen starts the plc on the address of the network "tcp" or "udp" like ":5011".
+func Listen(network, address string) (*Server, error) {
+	s := newServer()
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		ln, err := net.Listen(network, address)
+		if err != nil {
+			return nil, err
+		}
+		s.ln = ln
+		s.wg.Add(1)
+		go s.serveTCP()
+	case "udp", "udp4", "udp6":
+		conn, err := net.ListenPacket(network, address)
+		if err != nil {
+			return nil, err
+		}
+		s.udp = conn
+		s.wg.Add(1)
+		go s.serveUDP()
+	default:
+		return nil, fmt.Errorf("unsupported network: %s", network)
+	}
+	return s, nil
+}
+
+func newServer() *Server {
+	return &Server{
+		mem:       newMemory(),
+		modelName: "Q03UDVCPU",
+		modelCode: 0x0366,
+		done:      make(chan struct{}),
+		conns:     map[net.Conn]struct{}{},
+	}
+}
+
+// Addr returns the address of the plc like 127.0.0.1:5011.
+func (s *Server) Addr() net.Addr {
+	if s.udp != nil {
+		return s.udp.LocalAddr()
+	}
+	return s.ln.Addr()
+}
+
+// Host returns the host of the plc.
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr().String())
+	return host
+}
+
+// Port returns the port of the plc.
+func (s *Server) Port() int {
+	_, port, _ := net.SplitHostPort(s.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+// SetLatency sets the delay of each response.
+func (s *Server) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = latency
+}
+
+// InjectFault injects the faults to the responses of the next requests in order.
+func (s *Server) InjectFault(faults ...Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, faults...)
+}
+
+// SetPassword sets remote password. the requests of the connection are answered with C201h
+// until the password is unlocked.
+func (s *Server) SetPassword(password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.password = password
+}
+
+// SetCPUModel sets CPU model name and model code. default is Q03UDVCPU (0366h).
+func (s *Server) SetCPUModel(name string, code uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.modelName, s.modelCode = name, code
+}
+
+// Requests returns number of the received requests.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Close stops the plc and closes all connections. the second Close does nothing and returns nil.
+func (s *Server) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		if s.udp != nil {
+			err = s.udp.Close()
+		} else {
+			err = s.ln.Close()
+		}
+		s.mu.Lock()
+		s.closed = true
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+		s.wg.Wait()
+	})
+	return err
+}
+
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// serveConn answers the requests of the connection until it is closed.
+func (s *Server) serveConn(conn net.Conn) {
+	sess := &session{}
+	for {
+		req, err := readRequest(conn)
+		if err != nil {
+			return
+		}
+		resp, ok := s.serve(sess, req)
+		if !ok {
+			return
+		}
+		if _, err := conn.Write(resp); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+	// UDP has no connection, the password is unlocked by the client address.
+	sessions := map[string]*session{}
+	buff := make([]byte, 8192)
+	for {
+		n, addr, err := s.udp.ReadFrom(buff)
+		if err != nil {
+			return
+		}
+		sess, ok := sessions[addr.String()]
+		if !ok {
+			sess = &session{}
+			sessions[addr.String()] = sess
+		}
+		req, err := parseRequest(buff[:n])
+		if err != nil {
+			continue
+		}
+		resp, ok := s.serve(sess, req)
+		if !ok {
+			continue
+		}
+		s.udp.WriteTo(resp, addr)
+	}
+}
+
+// session is the state of the connection.
+type session struct {
+	// remote password is unlocked
+	unlocked bool
+	// request data of the monitor registration. it is same as random read.
+	monitor []byte
+	// monitor registration is MELSEC iQ-R device addressing
+	monitorIQR bool
+}
+
+// request is 3E or 4E binary request frame.
+type request struct {
+	is4E   bool
+	serial uint16
+	// network num + PC num + unit I/O num + unit station num
+	route []byte
+	// command + sub command + request data
+	command    uint16
+	subCommand uint16
+	data       []byte
+}
+
+// readRequest reads one request frame from r.
+func readRequest(r io.Reader) (*request, error) {
+	subHeader := make([]byte, 2)
+	if _, err := io.ReadFull(r, subHeader); err != nil {
+		return nil, err
+	}
+	headerSize := 9
+	if subHeader[0] == 0x54 {
+		headerSize += 4
+	}
+	frame := make([]byte, headerSize)
+	copy(frame, subHeader)
+	if _, err := io.ReadFull(r, frame[2:]); err != nil {
+		return nil, err
+	}
+	dataLen := int(binary.LittleEndian.Uint16(frame[headerSize-2:]))
+	frame = append(frame, make([]byte, dataLen)...)
+	if _, err := io.ReadFull(r, frame[headerSize:]); err != nil {
+		return nil, err
+	}
+	return parseRequest(frame)
+}
+
+// parseRequest parses one request frame.
+func parseRequest(frame []byte) (*request, error) {
+	req := &request{}
+	switch {
+	case len(frame) >= 2 && frame[0] == 0x50 && frame[1] == 0x00:
+		frame = frame[2:]
+	case len(frame) >= 6 && frame[0] == 0x54 && frame[1] == 0x00:
+		req.is4E = true
+		req.serial = binary.LittleEndian.Uint16(frame[2:4])
+		frame = frame[6:]
+	default:
+		return nil, errors.New("invalid sub header")
+	}
+	// route + request data length + monitoring timer + command + sub command
+	if len(frame) < 5+2+2+2+2 {
+		return nil, errors.New("request is too short")
+	}
+	if int(binary.LittleEndian.Uint16(frame[5:7])) != len(frame)-7 {
+		return nil, errors.New("request data length does not match")
+	}
+	req.route = frame[0:5]
+	req.command = binary.LittleEndian.Uint16(frame[9:11])
+	req.subCommand = binary.LittleEndian.Uint16(frame[11:13])
+	req.data = frame[13:]
+	return req, nil
+}
+
+// serve executes the request and returns the response frame. false is returned when the response is dropped.
+func (s *Server) serve(sess *session, req *request) ([]byte, bool) {
+	s.mu.Lock()
+	s.requests++
+	latency := s.latency
+	var fault Fault
+	if len(s.faults) > 0 {
+		fault = s.faults[0]
+		s.faults = s.faults[1:]
+	}
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-s.done:
+			return nil, false
+		}
+	}
+	if fault.Drop {
+		return nil, false
+	}
+
+	endCode, data := fault.EndCode, []byte(nil)
+	if endCode == 0 {
+		endCode, data = s.execute(sess, req)
+	}
+	return response(req, endCode, data), true
+}
+
+// response returns the response frame of the request. the data of abnormal end is error information.
+func response(req *request, endCode uint16, data []byte) []byte {
+	var resp []byte
+	if req.is4E {
+		resp = []byte{0xD4, 0x00, byte(req.serial), byte(req.serial >> 8), 0x00, 0x00}
+	} else {
+		resp = []byte{0xD0, 0x00}
+	}
+	resp = append(resp, req.route...)
+	if endCode != 0 {
+		// error information is route + command + sub command
+		data = append(append([]byte{}, req.route...),
+			byte(req.command), byte(req.command>>8), byte(req.subCommand), byte(req.subCommand>>8))
+	}
+	resp = appendUint(resp, 2+len(data), 2)
+	resp = appendUint(resp, int(endCode), 2)
+	return append(resp, data...)
+}
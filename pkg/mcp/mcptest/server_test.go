@@ -0,0 +1,339 @@
+package mcptest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"nk2-PLCcapture-go/pkg/mcp"
+	"nk2-PLCcapture-go/pkg/mcp/mcptest"
+)
+
+// newClientFunc returns the client of the frame connected to the plc.
+type newClientFunc func(host string, port int, opts ...mcp.Option) (mcp.Client, error)
+
+var (
+	new3EClient newClientFunc = func(host string, port int, opts ...mcp.Option) (mcp.Client, error) {
+		return mcp.New3EClient(host, port, mcp.NewLocalStation(), opts...)
+	}
+	new4EClient newClientFunc = func(host string, port int, opts ...mcp.Option) (mcp.Client, error) {
+		return mcp.New4EClient(host, port, mcp.NewLocalStation(), opts...)
+	}
+	new3EUDPClient newClientFunc = func(host string, port int, opts ...mcp.Option) (mcp.Client, error) {
+		return mcp.New3EUDPClient(host, port, mcp.NewLocalStation(), opts...)
+	}
+	new4EUDPClient newClientFunc = func(host string, port int, opts ...mcp.Option) (mcp.Client, error) {
+		return mcp.New4EUDPClient(host, port, mcp.NewLocalStation(), opts...)
+	}
+)
+
+// newPLC starts the plc and returns the client of the frame connected to it.
+func newPLC(t *testing.T, network string, newClient newClientFunc, opts ...mcp.Option) (*mcptest.Server, mcp.Client) {
+	t.Helper()
+	plc, err := mcptest.Listen(network, "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start plc: %v", err)
+	}
+	t.Cleanup(func() { plc.Close() })
+	client, err := newClient(plc.Host(), plc.Port(), opts...)
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return plc, client
+}
+
+func TestServer_Frames(t *testing.T) {
+	frames := []struct {
+		name      string
+		network   string
+		newClient newClientFunc
+	}{
+		{"3E", "tcp", new3EClient},
+		{"4E", "tcp", new4EClient},
+		{"3E UDP", "udp", new3EUDPClient},
+		{"4E UDP", "udp", new4EUDPClient},
+	}
+	for _, f := range frames {
+		t.Run(f.name, func(t *testing.T) {
+			plc, client := newPLC(t, f.network, f.newClient)
+			plc.SetWords("D", 100, 0x1234, 0x5678)
+			plc.SetBits("M", 10, true, false, true)
+
+			// batch read and write
+			resp, err := client.Read("D", 100, 2)
+			if err != nil {
+				t.Fatalf("unexpected mcp read err: %v", err)
+			}
+			response, err := mcp.NewParser().Do(resp)
+			if err != nil {
+				t.Fatalf("unexpected parser err: %v", err)
+			}
+			if string(response.Payload) != "\x34\x12\x78\x56" {
+				t.Fatalf("unexpected read payload %X", response.Payload)
+			}
+			resp, err = client.BitRead("M", 10, 3)
+			if err != nil {
+				t.Fatalf("unexpected mcp bit read err: %v", err)
+			}
+			if response, _ := mcp.NewParser().Do(resp); string(response.Payload) != "\x10\x10" {
+				t.Fatalf("unexpected bit read payload %X", response.Payload)
+			}
+			if _, err := client.Write("D", 200, 2, []byte{0x01, 0x00, 0x02, 0x00}); err != nil {
+				t.Fatalf("unexpected mcp write err: %v", err)
+			}
+			if w := plc.Words("D", 200, 2); w[0] != 1 || w[1] != 2 {
+				t.Fatalf("unexpected written words %v", w)
+			}
+
+			// random read and write
+			d100 := mcp.DeviceAddr{DeviceName: "D", Offset: 100}
+			d300 := mcp.DeviceAddr{DeviceName: "D", Offset: 300}
+			m20 := mcp.DeviceAddr{DeviceName: "M", Offset: 20}
+			if err := client.WriteRandomWords(map[mcp.DeviceAddr]uint16{d300: 7}, nil); err != nil {
+				t.Fatalf("unexpected mcp random write err: %v", err)
+			}
+			if err := client.WriteRandomBits(map[mcp.DeviceAddr]bool{m20: true}); err != nil {
+				t.Fatalf("unexpected mcp random bit write err: %v", err)
+			}
+			if !plc.Bits("M", 20, 1)[0] {
+				t.Fatalf("M20 is not set")
+			}
+			words, dwords, err := client.ReadRandom([]mcp.DeviceAddr{d300}, []mcp.DeviceAddr{d100})
+			if err != nil {
+				t.Fatalf("unexpected mcp random read err: %v", err)
+			}
+			if words[d300] != 7 || dwords[d100] != 0x56781234 {
+				t.Fatalf("unexpected random read values %v %v", words, dwords)
+			}
+
+			// block read and write
+			err = client.WriteBlocks([]mcp.Block{{DeviceAddr: mcp.DeviceAddr{DeviceName: "W", Offset: 0}, Data: []uint16{3, 4}}}, nil)
+			if err != nil {
+				t.Fatalf("unexpected mcp block write err: %v", err)
+			}
+			wordBlocks, bitBlocks, err := client.ReadBlocks(
+				[]mcp.Block{{DeviceAddr: mcp.DeviceAddr{DeviceName: "W", Offset: 0}, Points: 2}},
+				[]mcp.Block{{DeviceAddr: mcp.DeviceAddr{DeviceName: "M", Offset: 10}, Points: 1}})
+			if err != nil {
+				t.Fatalf("unexpected mcp block read err: %v", err)
+			}
+			if wordBlocks[0][0] != 3 || wordBlocks[0][1] != 4 || bitBlocks[0][0] != 0x0405 {
+				t.Fatalf("unexpected block read values %v %v", wordBlocks, bitBlocks)
+			}
+
+			// monitor
+			monitor, err := client.RegisterMonitor([]mcp.DeviceAddr{d300}, nil)
+			if err != nil {
+				t.Fatalf("unexpected mcp monitor register err: %v", err)
+			}
+			plc.SetWords("D", 300, 8)
+			if words, _, err := monitor.Execute(); err != nil || words[d300] != 8 {
+				t.Fatalf("unexpected monitor values %v err %v", words, err)
+			}
+
+			if err := client.HealthCheck(); err != nil {
+				t.Fatalf("unexpected health check err: %v", err)
+			}
+			model, err := client.ReadCPUModel()
+			if err != nil || model.Name != "Q03UDVCPU" || model.Code != 0x0366 {
+				t.Fatalf("unexpected cpu model %v err %v", model, err)
+			}
+		})
+	}
+}
+
+func TestServer_Fault(t *testing.T) {
+	plc, client := newPLC(t, "tcp", new3EClient, mcp.WithBackoff(mcp.Backoff{}))
+
+	plc.InjectFault(mcptest.Fault{EndCode: 0xC051}, mcptest.Fault{Drop: true})
+	_, err := client.Read("D", 0, 1)
+	var endCodeErr *mcp.EndCodeError
+	if !errors.As(err, &endCodeErr) || endCodeErr.EndCode != 0xC051 || endCodeErr.Command != 0x0401 {
+		t.Fatalf("expected end code C051 but %v", err)
+	}
+	if _, err := client.Read("D", 0, 1); err == nil {
+		t.Fatalf("expected connection error but nil")
+	}
+	// the client reconnects
+	if _, err := client.Read("D", 0, 1); err != nil {
+		t.Fatalf("unexpected mcp read err: %v", err)
+	}
+	if n := plc.Requests(); n != 3 {
+		t.Fatalf("expected 3 requests but %v", n)
+	}
+
+	// unsupported device access
+	if _, err := client.BitRead("D", 0, 1); !errors.As(err, &endCodeErr) || endCodeErr.EndCode != mcptest.EndCodeDevice {
+		t.Fatalf("expected end code C05B but %v", err)
+	}
+}
+
+func TestServer_Latency(t *testing.T) {
+	plc, client := newPLC(t, "tcp", new4EClient)
+	plc.SetLatency(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.ReadContext(ctx, "D", 0, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded but %v", err)
+	}
+	if _, err := client.Read("D", 0, 1); err != nil {
+		t.Fatalf("unexpected mcp read err: %v", err)
+	}
+}
+
+func TestServer_Password(t *testing.T) {
+	plc, err := mcptest.NewServer()
+	if err != nil {
+		t.Fatalf("failed to start plc: %v", err)
+	}
+	defer plc.Close()
+	plc.SetPassword("pass1234")
+
+	locked, err := mcp.New3EClient(plc.Host(), plc.Port(), mcp.NewLocalStation())
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer locked.Close()
+	var endCodeErr *mcp.EndCodeError
+	if _, err := locked.Read("D", 0, 1); !errors.As(err, &endCodeErr) || endCodeErr.EndCode != mcptest.EndCodeLocked {
+		t.Fatalf("expected end code C201 but %v", err)
+	}
+
+	unlocked, err := mcp.New3EClient(plc.Host(), plc.Port(), mcp.NewLocalStation(), mcp.WithPassword("pass1234"))
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer unlocked.Close()
+	if _, err := unlocked.Read("D", 0, 1); err != nil {
+		t.Fatalf("unexpected mcp read err: %v", err)
+	}
+}
+
+// newPool starts the plc and returns the pool of n connections to it.
+func newPool(t *testing.T, n int) (*mcptest.Server, *mcp.Pool) {
+	t.Helper()
+	plc, err := mcptest.NewServer()
+	if err != nil {
+		t.Fatalf("failed to start plc: %v", err)
+	}
+	t.Cleanup(func() { plc.Close() })
+	pool, err := mcp.New3EPool(plc.Host(), []int{plc.Port()}, n, mcp.NewLocalStation())
+	if err != nil {
+		t.Fatalf("unexpected pool err: %v", err)
+	}
+	t.Cleanup(func() { pool.Close() })
+	return plc, pool
+}
+
+func TestPool_Monitor(t *testing.T) {
+	plc, pool := newPool(t, 3)
+
+	d300 := mcp.DeviceAddr{DeviceName: "D", Offset: 300}
+	monitor, err := pool.RegisterMonitor([]mcp.DeviceAddr{d300}, nil)
+	if err != nil {
+		t.Fatalf("unexpected mcp monitor register err: %v", err)
+	}
+	// the monitor is executed on the connection of the registration while the requests are spread over the pool
+	for i := 0; i < 6; i++ {
+		plc.SetWords("D", 300, uint16(i))
+		if words, _, err := monitor.Execute(); err != nil || words[d300] != uint16(i) {
+			t.Fatalf("unexpected monitor values %v err %v", words, err)
+		}
+		if _, err := pool.Read("D", 0, 1); err != nil {
+			t.Fatalf("unexpected mcp read err: %v", err)
+		}
+	}
+}
+
+func TestMonitor_Reconnect(t *testing.T) {
+	plc, client := newPLC(t, "tcp", new3EClient, mcp.WithBackoff(mcp.Backoff{}))
+
+	d300 := mcp.DeviceAddr{DeviceName: "D", Offset: 300}
+	monitor, err := client.RegisterMonitor([]mcp.DeviceAddr{d300}, nil)
+	if err != nil {
+		t.Fatalf("unexpected mcp monitor register err: %v", err)
+	}
+	// the connection is dropped by the other request, the registration is lost by the reconnection
+	plc.InjectFault(mcptest.Fault{Drop: true})
+	if _, err := client.Read("D", 0, 1); err == nil {
+		t.Fatalf("expected dropped connection error but nil")
+	}
+	plc.SetWords("D", 300, 0x1234)
+	words, _, err := monitor.Execute()
+	if err != nil {
+		t.Fatalf("unexpected mcp monitor err: %v", err)
+	}
+	if words[d300] != 0x1234 {
+		t.Errorf("expected 1234 but actual is %04X", words[d300])
+	}
+}
+
+func TestPool_Unlock(t *testing.T) {
+	plc, pool := newPool(t, 3)
+	plc.SetPassword("pass1234")
+
+	if err := pool.Unlock("pass1234"); err != nil {
+		t.Fatalf("unexpected unlock err: %v", err)
+	}
+	// all the connections are unlocked
+	for i := 0; i < 6; i++ {
+		if _, err := pool.Read("D", 0, 1); err != nil {
+			t.Fatalf("unexpected mcp read err: %v", err)
+		}
+	}
+
+	if err := pool.Lock("pass1234"); err != nil {
+		t.Fatalf("unexpected lock err: %v", err)
+	}
+	var endCodeErr *mcp.EndCodeError
+	for i := 0; i < 3; i++ {
+		if _, err := pool.Read("D", 0, 1); !errors.As(err, &endCodeErr) || endCodeErr.EndCode != mcptest.EndCodeLocked {
+			t.Fatalf("expected end code C201 but %v", err)
+		}
+	}
+}
+
+func TestPool_ReadRandomParallel(t *testing.T) {
+	plc, pool := newPool(t, 3)
+	latency := 50 * time.Millisecond
+	plc.SetLatency(latency)
+
+	// 576 words are 3 requests of 192 points, they are sent on the 3 connections at the same time
+	words := make([]mcp.DeviceAddr, 576)
+	for i := range words {
+		words[i] = mcp.DeviceAddr{DeviceName: "D", Offset: int64(i)}
+		plc.SetWords("D", i, uint16(i))
+	}
+	start := time.Now()
+	values, _, err := pool.ReadRandom(words, nil)
+	if err != nil {
+		t.Fatalf("unexpected mcp random read err: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 2*latency {
+		t.Fatalf("requests are not sent in parallel: %v", elapsed)
+	}
+	for i, addr := range words {
+		if values[addr] != uint16(i) {
+			t.Fatalf("expected %v of %v but actual is %v", i, addr, values[addr])
+		}
+	}
+}
+
+func TestServer_Close(t *testing.T) {
+	for _, network := range []string{"tcp", "udp"} {
+		plc, err := mcptest.Listen(network, "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to start plc: %v", err)
+		}
+		if err := plc.Close(); err != nil {
+			t.Fatalf("unexpected close err: %v", err)
+		}
+		// second Close like t.Cleanup after the explicit Close
+		if err := plc.Close(); err != nil {
+			t.Fatalf("unexpected second close err: %v", err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// END_CODE_NO_MONITOR is the end code of the monitor command without the monitor registration.
+const END_CODE_NO_MONITOR = 0xC05D
+
+// Monitor is the device set registered to the plc by monitor registration command.
+// Once registered, Execute reads all the devices by a small monitor command that has no request data.
+// The registration is kept by the plc per connection and only the last one is valid,
+// so one client should have one Monitor at a time. the Monitor of Pool is pinned to one connection of the pool.
+type Monitor struct {
+	client *baseClient
+	// word devices read as word (16bit)
+	words []DeviceAddr
+	// double word devices read as double word (32bit)
+	dwords []DeviceAddr
+	// Mutex to synchronize access to registered
+	mu sync.Mutex
+	// the devices are registered to the plc.
+	registered bool
+}
+
+// RegisterMonitor is send monitor registration command of the devices to remote plc.
+// the number of devices is same as the limit of random read.
+func (c *baseClient) RegisterMonitor(words, dwords []DeviceAddr) (*Monitor, error) {
+	return c.RegisterMonitorContext(context.Background(), words, dwords)
+}
+
+// RegisterMonitorContext is RegisterMonitor with the context. the request is canceled when ctx is done.
+func (c *baseClient) RegisterMonitorContext(ctx context.Context, words, dwords []DeviceAddr) (*Monitor, error) {
+	// MELSEC-Q/L: word points + double word points <= 192, MELSEC iQ-R: <= 96
+	maxPoints := 192
+	if c.stn.series == IQRSeries {
+		maxPoints = 96
+	}
+	if points := len(words) + len(dwords); points > maxPoints {
+		return nil, fmt.Errorf("monitor points %v is over the limit %v", points, maxPoints)
+	}
+	if err := c.stn.checkDevices(append(append([]DeviceAddr{}, words...), dwords...)...); err != nil {
+		return nil, err
+	}
+
+	client := c
+	if mc, ok := c.tr.(multiConnTransport); ok {
+		// the monitor command must be sent on the connection of the registration
+		client = &baseClient{stn: c.stn, code: c.code, tr: mc.pinConn(), password: c.password}
+	}
+	m := &Monitor{
+		client: client,
+		words:  append([]DeviceAddr{}, words...),
+		dwords: append([]DeviceAddr{}, dwords...),
+	}
+	if err := m.register(ctx); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Execute is send monitor command and returns the value of each registered device.
+// If the previous monitor is failed (e.g. the connection is lost), the devices are registered again.
+// If the plc answers the registration is lost (C05Dh, e.g. the connection is reconnected by the other request),
+// the devices are registered again and the monitor is retried once.
+func (m *Monitor) Execute() (map[DeviceAddr]uint16, map[DeviceAddr]uint32, error) {
+	return m.ExecuteContext(context.Background())
+}
+
+// ExecuteContext is Execute with the context. the request is canceled when ctx is done.
+func (m *Monitor) ExecuteContext(ctx context.Context) (map[DeviceAddr]uint16, map[DeviceAddr]uint32, error) {
+	if err := m.register(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	wordValues, dwordValues, err := m.execute(ctx)
+	var endCodeErr *EndCodeError
+	if errors.As(err, &endCodeErr) && endCodeErr.EndCode == END_CODE_NO_MONITOR {
+		// the registration is lost by the reconnection of the other request or the failover of Pool.
+		// register again and retry once.
+		if err := m.register(ctx); err != nil {
+			return nil, nil, err
+		}
+		wordValues, dwordValues, err = m.execute(ctx)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return wordValues, dwordValues, nil
+}
+
+// execute sends monitor command. the devices are registered again by the next register if it is failed.
+func (m *Monitor) execute(ctx context.Context) (map[DeviceAddr]uint16, map[DeviceAddr]uint32, error) {
+	wordValues := make(map[DeviceAddr]uint16, len(m.words))
+	dwordValues := make(map[DeviceAddr]uint32, len(m.dwords))
+	buff := getBuffer()
+	defer putBuffer(buff)
+	*buff = m.client.stn.appendMonitorCommand(*buff, m.client.code)
+	if err := m.client.requestRandom(ctx, *buff, m.words, m.dwords, wordValues, dwordValues); err != nil {
+		m.mu.Lock()
+		m.registered = false
+		m.mu.Unlock()
+		return nil, nil, err
+	}
+	return wordValues, dwordValues, nil
+}
+
+// register sends monitor registration command if the devices are not registered.
+func (m *Monitor) register(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.registered {
+		return nil
+	}
+	command := m.client.stn.appendMonitorRegisterCommand(nil, m.client.code, m.words, m.dwords)
+	if _, err := m.client.request(ctx, command, 0, m.client.code.decodeWords); err != nil {
+		return err
+	}
+	m.registered = true
+	return nil
+}
@@ -0,0 +1,62 @@
+package mcp
+
+import "testing"
+
+func TestStation_BuildMonitorCommand(t *testing.T) {
+	station := NewLocalStation()
+
+	command := Binary.string(station.appendMonitorRegisterCommand(nil, Binary,
+		[]DeviceAddr{{DeviceName: "D", Offset: 300}}, []DeviceAddr{{DeviceName: "D", Offset: 400}}))
+	if command != "01080000"+"0101"+"2C0100A8"+"900100A8" {
+		t.Fatalf("expected %v but actual is %v", "0108000001012C0100A8900100A8", command)
+	}
+
+	if command := Ascii.string(station.appendMonitorCommand(nil, Ascii)); command != "08020000" {
+		t.Fatalf("expected %v but actual is %v", "08020000", command)
+	}
+}
+
+func TestMonitor_Execute(t *testing.T) {
+	host, port := servePLC(t,
+		"d000 00 ff ff03 00 0200 0000",                        // register
+		"d000 00 ff ff03 00 0c00 0000 3412 78563412 00000000", // monitor
+		"d000 00 ff ff03 00 0b00 55c0 00ff ff03 00 0208 0000", // monitor error
+		"d000 00 ff ff03 00 0200 0000",                        // register again
+		"d000 00 ff ff03 00 0c00 0000 cdab 00000000 00000000", // monitor
+	)
+
+	client, err := New3EClient(host, port, NewLocalStation())
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	d300 := DeviceAddr{DeviceName: "D", Offset: 300}
+	d400 := DeviceAddr{DeviceName: "D", Offset: 400}
+	d402 := DeviceAddr{DeviceName: "D", Offset: 402}
+
+	monitor, err := client.RegisterMonitor([]DeviceAddr{d300}, []DeviceAddr{d400, d402})
+	if err != nil {
+		t.Fatalf("unexpected monitor register err: %v", err)
+	}
+
+	words, dwords, err := monitor.Execute()
+	if err != nil {
+		t.Fatalf("unexpected monitor err: %v", err)
+	}
+	if words[d300] != 0x1234 || dwords[d400] != 0x12345678 {
+		t.Fatalf("unexpected values %v %v", words, dwords)
+	}
+
+	if _, _, err := monitor.Execute(); err == nil {
+		t.Fatalf("expected end code error but nil")
+	}
+
+	words, _, err = monitor.Execute()
+	if err != nil {
+		t.Fatalf("unexpected monitor err after register again: %v", err)
+	}
+	if words[d300] != 0xABCD {
+		t.Fatalf("unexpected values %v", words)
+	}
+}
@@ -0,0 +1,98 @@
+package mcp
+
+import "time"
+
+// Option configures the mc protocol client.
+type Option func(*options)
+
+type options struct {
+	// data communication code. default is Binary.
+	code Code
+	// remote password. the connection is unlocked on connect if it is set.
+	password string
+	// time to wait for the response of one UDP datagram. default is 3 seconds.
+	timeout time.Duration
+	// number of resends of UDP request when the response is not received. default is 2.
+	retries int
+	// delay of the reconnection. default is DefaultBackoff.
+	backoff Backoff
+	// handler of the connection state change
+	stateHandler StateHandler
+	// station number of the serial communication module. default is 0.
+	stationNum uint8
+	// sum check code of the serial frame. default is true.
+	sumCheck bool
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		code:     Binary,
+		timeout:  3 * time.Second,
+		retries:  2,
+		backoff:  DefaultBackoff,
+		sumCheck: true,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithCode sets data communication code that is configured on the plc ethernet module.
+func WithCode(code Code) Option {
+	return func(o *options) {
+		o.code = code
+	}
+}
+
+// WithPassword sets remote password of the plc ethernet module.
+// the client unlocks the password every time it connects to the plc.
+func WithPassword(password string) Option {
+	return func(o *options) {
+		o.password = password
+	}
+}
+
+// WithTimeout sets time to wait for the response of one UDP datagram.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithRetries sets number of resends of UDP request when the response is not received in the timeout.
+func WithRetries(retries int) Option {
+	return func(o *options) {
+		o.retries = retries
+	}
+}
+
+// WithBackoff sets the delay of the reconnection after the connection is lost or failed.
+// zero Backoff reconnects without the delay.
+func WithBackoff(backoff Backoff) Option {
+	return func(o *options) {
+		o.backoff = backoff
+	}
+}
+
+// WithStateHandler sets the handler which is called when the connection state is changed.
+func WithStateHandler(handler StateHandler) Option {
+	return func(o *options) {
+		o.stateHandler = handler
+	}
+}
+
+// WithStationNum sets station number of the serial communication module which is the target of 3C and 4C frame.
+func WithStationNum(stationNum uint8) Option {
+	return func(o *options) {
+		o.stationNum = stationNum
+	}
+}
+
+// WithSumCheck sets whether the sum check code is added to 3C and 4C frame.
+// it must be same as the setting of the serial communication module.
+func WithSumCheck(sumCheck bool) Option {
+	return func(o *options) {
+		o.sumCheck = sumCheck
+	}
+}
@@ -0,0 +1,61 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+)
+
+// Unlock is send remote password unlock command to remote plc.
+// MELSEC-Q/L password is 4 characters, MELSEC iQ-R is 6 to 32 characters.
+func (c *baseClient) Unlock(password string) error {
+	return c.UnlockContext(context.Background(), password)
+}
+
+// UnlockContext is Unlock with the context. the request is canceled when ctx is done.
+func (c *baseClient) UnlockContext(ctx context.Context, password string) error {
+	return c.remotePassword(ctx, UNLOCK_COMMAND, password)
+}
+
+// Lock is send remote password lock command to remote plc.
+// the password is unlocked or locked per connection, so Pool sends the command on all the connections.
+func (c *baseClient) Lock(password string) error {
+	return c.LockContext(context.Background(), password)
+}
+
+// LockContext is Lock with the context. the request is canceled when ctx is done.
+func (c *baseClient) LockContext(ctx context.Context, password string) error {
+	return c.remotePassword(ctx, LOCK_COMMAND, password)
+}
+
+func (c *baseClient) remotePassword(ctx context.Context, command, password string) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+	mc, ok := c.tr.(multiConnTransport)
+	if !ok {
+		_, err := c.request(ctx, c.stn.appendPasswordCommand(nil, c.code, command, password), 0, c.code.decodeWords)
+		return err
+	}
+	// the first error is returned after the command is sent on all the connections
+	var firstErr error
+	for _, tr := range mc.eachConn() {
+		conn := &baseClient{stn: c.stn, code: c.code, tr: tr, password: c.password}
+		if err := conn.remotePassword(ctx, command, password); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// validatePassword checks the password is 4 to 32 ascii characters.
+func validatePassword(password string) error {
+	if len(password) < 4 || len(password) > 32 {
+		return fmt.Errorf("password must be 4 to 32 characters but %v", len(password))
+	}
+	for _, r := range password {
+		if r < 0x20 || r > 0x7E {
+			return fmt.Errorf("password must be ascii characters")
+		}
+	}
+	return nil
+}
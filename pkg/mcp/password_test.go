@@ -0,0 +1,74 @@
+package mcp
+
+import "testing"
+
+func TestStation_BuildPasswordCommand(t *testing.T) {
+	station := NewLocalStation()
+
+	cases := []struct {
+		actual   string
+		expected string
+	}{
+		{
+			actual:   Binary.string(station.appendPasswordCommand(nil, Binary, UNLOCK_COMMAND, "ABCD")),
+			expected: "30160000" + "0400" + "41424344",
+		},
+		{
+			actual:   Ascii.string(station.appendPasswordCommand(nil, Ascii, LOCK_COMMAND, "ABCD")),
+			expected: "16310000" + "0004" + "ABCD",
+		},
+	}
+
+	for _, v := range cases {
+		if v.actual != v.expected {
+			t.Errorf("expected %v but actual is %v", v.expected, v.actual)
+		}
+	}
+}
+
+func TestClient3E_UnlockOnConnect(t *testing.T) {
+	host, port := servePLC(t,
+		"d000 00 ff ff03 00 0200 0000",      // unlock
+		"d000 00 ff ff03 00 0400 0000 0100", // read
+	)
+
+	client, err := New3EClient(host, port, NewLocalStation(), WithPassword("ABCD"))
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	resp, err := client.Read("D", 100, 1)
+	if err != nil {
+		t.Fatalf("unexpected read err: %v", err)
+	}
+	if len(resp) != 13 || resp[11] != 0x01 {
+		t.Fatalf("unexpected read response: %X", resp)
+	}
+}
+
+func TestClient3E_UnlockFailure(t *testing.T) {
+	host, port := servePLC(t,
+		"d000 00 ff ff03 00 0b00 5dc0 00ff ff03 00 3016 0000", // unlock with error end code
+	)
+
+	client, err := New3EClient(host, port, NewLocalStation(), WithPassword("ABCD"))
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.Read("D", 100, 1); err == nil {
+		t.Fatalf("expected unlock error but actual is nil")
+	}
+}
+
+func TestClient_UnlockInvalidPassword(t *testing.T) {
+	client, err := New3EClient("127.0.0.1", 5000, NewLocalStation())
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	if err := client.Unlock("ABC"); err == nil {
+		t.Fatalf("expected password length error but actual is nil")
+	}
+}
@@ -0,0 +1,230 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Pool is mc protocol client of 3E frame which spreads the requests over several connections.
+// the ethernet module accepts one connection on each open connection port (e.g. 5011, 5012, ...),
+// so the requests of the goroutines are sent in parallel on the connections of the ports.
+// the request is sent on the healthy connection which has the least requests in flight.
+type Pool struct {
+	baseClient
+	// Mutex to synchronize access to conns, next and state
+	mu sync.Mutex
+	// pooled connections
+	conns []*poolConn
+	// index of the connection which is tried first on the next request
+	next int
+	// delay of the retry of the failed connection
+	backoff Backoff
+	// handler of the pool state change
+	handler StateHandler
+	// state of the pool. it is up when any connection is up.
+	state ConnState
+}
+
+// poolConn is one connection of the pool and its health.
+type poolConn struct {
+	// connection of the port
+	tr   *client3E
+	port int
+	// connection state reported by tr
+	state ConnState
+	// number of consecutive failed requests
+	failures int
+	// error of the last failed request
+	lastErr error
+	// the failed connection is not used before this time while the other connection is healthy
+	retryAt time.Time
+	// number of requests in flight
+	inFlight int
+}
+
+// ConnHealth is the health of the connection of the pool.
+type ConnHealth struct {
+	// port of the connection
+	Port int
+	// connection state
+	State ConnState
+	// number of consecutive failed requests
+	Failures int
+	// error of the last failed request. nil after the request is succeeded.
+	LastErr error
+	// number of requests in flight
+	InFlight int
+}
+
+// New3EPool returns the pool of connsPerPort connections to each port of the host.
+// the state handler of the options is called by the state of the pool, not by each connection.
+func New3EPool(host string, ports []int, connsPerPort int, stn *station, opts ...Option) (*Pool, error) {
+	if len(ports) == 0 {
+		return nil, errors.New("no port of the pool")
+	}
+	if connsPerPort < 1 {
+		return nil, fmt.Errorf("connections per port must be 1 or more: %d", connsPerPort)
+	}
+	o := newOptions(opts)
+	p := &Pool{backoff: o.backoff, handler: o.stateHandler}
+	for _, port := range ports {
+		tcpAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%v:%v", host, port))
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < connsPerPort; i++ {
+			pc := &poolConn{port: port}
+			co := *o
+			co.stateHandler = func(state ConnState, err error) { p.setState(pc, state, err) }
+			pc.tr = newClient3E(tcpAddr, stn, &co)
+			p.conns = append(p.conns, pc)
+		}
+	}
+	p.baseClient = baseClient{stn: stn, code: o.code, tr: p, password: o.password}
+	return p, nil
+}
+
+func (p *Pool) roundTrip(ctx context.Context, stn *station, command []byte, respSize int64) ([]byte, error) {
+	p.mu.Lock()
+	pc := p.pick()
+	pc.inFlight++
+	p.mu.Unlock()
+	return p.send(ctx, pc, stn, command, respSize)
+}
+
+// send sends the request on the connection which counts the request in flight and records the result.
+func (p *Pool) send(ctx context.Context, pc *poolConn, stn *station, command []byte, respSize int64) ([]byte, error) {
+	resp, err := pc.tr.roundTrip(ctx, stn, command, respSize)
+	p.release(pc, err, ctx.Err() != nil)
+	return resp, err
+}
+
+// pinConn returns the transport of the connection which is picked for the next request.
+func (p *Pool) pinConn() transport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return &pinnedConn{pool: p, pc: p.pick()}
+}
+
+// eachConn returns the transports of all the connections.
+func (p *Pool) eachConn() []transport {
+	trs := make([]transport, len(p.conns))
+	for i, pc := range p.conns {
+		trs[i] = &pinnedConn{pool: p, pc: pc}
+	}
+	return trs
+}
+
+// pinnedConn is the transport of one connection of the pool. the health of the connection is recorded by the pool.
+type pinnedConn struct {
+	pool *Pool
+	pc   *poolConn
+}
+
+func (c *pinnedConn) roundTrip(ctx context.Context, stn *station, command []byte, respSize int64) ([]byte, error) {
+	c.pool.mu.Lock()
+	c.pc.inFlight++
+	c.pool.mu.Unlock()
+	return c.pool.send(ctx, c.pc, stn, command, respSize)
+}
+
+// pick returns the connection for the request. the healthy connection is preferred to the failed one,
+// and then the connection which has less requests in flight. ties are broken in round robin. p.mu must be held.
+func (p *Pool) pick() *poolConn {
+	now := time.Now()
+	var best *poolConn
+	for i := range p.conns {
+		pc := p.conns[(p.next+i)%len(p.conns)]
+		if best == nil || pc.better(best, now) {
+			best = pc
+		}
+	}
+	p.next = (p.next + 1) % len(p.conns)
+	return best
+}
+
+// better reports whether pc should be used rather than other.
+func (pc *poolConn) better(other *poolConn, now time.Time) bool {
+	if pc.healthy(now) != other.healthy(now) {
+		return pc.healthy(now)
+	}
+	return pc.inFlight < other.inFlight
+}
+
+// healthy reports whether the last request on the connection is not failed
+// or the failed connection can be retried.
+func (pc *poolConn) healthy(now time.Time) bool {
+	return pc.failures == 0 || !now.Before(pc.retryAt)
+}
+
+// release records the result of the request. canceled request does not affect the health.
+func (p *Pool) release(pc *poolConn, err error, canceled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pc.inFlight--
+	switch {
+	case err == nil:
+		pc.failures = 0
+		pc.lastErr = nil
+	case !canceled:
+		pc.retryAt = time.Now().Add(p.backoff.delay(pc.failures))
+		pc.failures++
+		pc.lastErr = err
+	}
+}
+
+// setState records the state of the connection and reports the state of the pool.
+// err is the cause of the down of the connection. it is called while the connection is locked.
+func (p *Pool) setState(pc *poolConn, state ConnState, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pc.state = state
+	poolState := StateDown
+	for _, c := range p.conns {
+		if c.state == StateUp {
+			poolState = StateUp
+			break
+		}
+		if c.state == StateConnecting {
+			poolState = StateConnecting
+		}
+	}
+	if poolState == p.state {
+		return
+	}
+	p.state = poolState
+	if p.handler != nil {
+		// the pool is down by the last connection which is down
+		p.handler(poolState, err)
+	}
+}
+
+// Health returns the health of each connection of the pool.
+func (p *Pool) Health() []ConnHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	health := make([]ConnHealth, len(p.conns))
+	for i, pc := range p.conns {
+		health[i] = ConnHealth{Port: pc.port, State: pc.state, Failures: pc.failures, LastErr: pc.lastErr, InFlight: pc.inFlight}
+	}
+	return health
+}
+
+// Close closes all connections of the pool. the first error is returned.
+func (p *Pool) Close() error {
+	var firstErr error
+	for _, pc := range p.conns {
+		if err := pc.tr.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
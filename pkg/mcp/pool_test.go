@@ -0,0 +1,141 @@
+package mcp
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serveSlowPLC starts tcp server that answers each 3E request after delay and counts the requests.
+func serveSlowPLC(t *testing.T, delay time.Duration, count *int32) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					if _, err := readRequest(conn, false); err != nil {
+						return
+					}
+					atomic.AddInt32(count, 1)
+					time.Sleep(delay)
+					if _, err := conn.Write([]byte{0xd0, 0x00, 0x00, 0xff, 0xff, 0x03, 0x00, 0x04, 0x00, 0x00, 0x00, 0x01, 0x00}); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestPool_Parallel(t *testing.T) {
+	var count1, count2 int32
+	delay := 50 * time.Millisecond
+	port1 := serveSlowPLC(t, delay, &count1)
+	port2 := serveSlowPLC(t, delay, &count2)
+
+	pool, err := New3EPool("127.0.0.1", []int{port1, port2}, 2, NewLocalStation())
+	if err != nil {
+		t.Fatalf("unexpected pool err: %v", err)
+	}
+	defer pool.Close()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := pool.Read("D", 0, 1); err != nil {
+				t.Errorf("unexpected mcp read err: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 8 requests on 4 connections are 2 round trips
+	if elapsed := time.Since(start); elapsed >= 4*delay {
+		t.Fatalf("requests are not sent in parallel: %v", elapsed)
+	}
+	if count1 != 4 || count2 != 4 {
+		t.Fatalf("requests are not spread: port1 %v port2 %v", count1, count2)
+	}
+	for _, h := range pool.Health() {
+		if h.State != StateUp || h.Failures != 0 || h.InFlight != 0 {
+			t.Fatalf("unexpected health %+v", h)
+		}
+	}
+}
+
+func TestPool_Health(t *testing.T) {
+	var count int32
+	port := serveSlowPLC(t, 0, &count)
+
+	// no plc on the port
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	deadPort := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	var mu sync.Mutex
+	var states []ConnState
+	handler := func(state ConnState, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		states = append(states, state)
+	}
+	pool, err := New3EPool("127.0.0.1", []int{deadPort, port}, 1, NewLocalStation(), WithStateHandler(handler))
+	if err != nil {
+		t.Fatalf("unexpected pool err: %v", err)
+	}
+
+	// first request is sent to the dead port
+	if _, err := pool.Read("D", 0, 1); err == nil {
+		t.Fatalf("expected connection error but nil")
+	}
+	// the failed connection is not used while the other connection is healthy
+	for i := 0; i < 5; i++ {
+		if _, err := pool.Read("D", 0, 1); err != nil {
+			t.Fatalf("unexpected mcp read err: %v", err)
+		}
+	}
+
+	health := pool.Health()
+	if health[0].Port != deadPort || health[0].State != StateDown || health[0].Failures != 1 || health[0].LastErr == nil {
+		t.Fatalf("unexpected health of dead port %+v", health[0])
+	}
+	if health[1].Port != port || health[1].State != StateUp || health[1].Failures != 0 {
+		t.Fatalf("unexpected health of alive port %+v", health[1])
+	}
+	if count != 5 {
+		t.Fatalf("expected 5 requests but %v", count)
+	}
+
+	pool.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []ConnState{StateConnecting, StateDown, StateConnecting, StateUp, StateDown}
+	if len(states) != len(expected) {
+		t.Fatalf("expected states %v but actual is %v", expected, states)
+	}
+	for i := range expected {
+		if states[i] != expected[i] {
+			t.Fatalf("expected states %v but actual is %v", expected, states)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package mcp
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// ConnState is the state of the connection to the plc.
+type ConnState int
+
+const (
+	// StateDown is the connection is closed or lost. it is the state before the first connection.
+	StateDown ConnState = iota
+	// StateConnecting is the client is connecting to the plc.
+	StateConnecting
+	// StateUp is the client is connected to the plc.
+	StateUp
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateDown:
+		return "down"
+	case StateConnecting:
+		return "connecting"
+	case StateUp:
+		return "up"
+	}
+	return "unknown"
+}
+
+// StateHandler is called when the connection state is changed.
+// err is the cause of StateDown, it is nil when the client is closed.
+// the handler is called while the connection is locked, so it must not block nor call the client.
+type StateHandler func(state ConnState, err error)
+
+// Backoff is the delay of the reconnection after the connection is lost or failed.
+// the delay starts from Min and is multiplied by Multiplier on each failure up to Max.
+// the delay is randomized by ±Jitter (0 to 1) of it, so many clients do not reconnect at the same time.
+type Backoff struct {
+	Min        time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+// DefaultBackoff is the backoff of the client by default.
+var DefaultBackoff = Backoff{Min: 100 * time.Millisecond, Max: 30 * time.Second, Multiplier: 2, Jitter: 0.2}
+
+// delay returns the delay before the reconnection of the attempt (0 is the first reconnection).
+func (b Backoff) delay(attempt int) time.Duration {
+	d := float64(b.Min)
+	for i := 0; i < attempt && d < float64(b.Max); i++ {
+		d *= b.Multiplier
+	}
+	if d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		d += d * b.Jitter * (2*rand.Float64() - 1)
+	}
+	if d < 0 {
+		return 0
+	}
+	return time.Duration(d)
+}
+
+// reconnector tracks the connection state and delays the reconnection by the backoff.
+// it is guarded by the mutex of the transport.
+type reconnector struct {
+	backoff Backoff
+	handler StateHandler
+	state   ConnState
+	// number of consecutive failures since the connection was up
+	failures int
+	// the reconnection is not tried before this time
+	next time.Time
+}
+
+func newReconnector(o *options) reconnector {
+	return reconnector{backoff: o.backoff, handler: o.stateHandler}
+}
+
+// wait waits for the backoff delay of the previous failure and reports StateConnecting.
+// ctx error is returned when ctx is done before the delay.
+func (r *reconnector) wait(ctx context.Context) error {
+	if d := time.Until(r.next); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	r.set(StateConnecting, nil)
+	return nil
+}
+
+// connect waits for the backoff delay and dials the new connection, and then prepares it by setup
+// (e.g. unlock of the remote password) before it is used by the requests. setup may be nil.
+// the connection is closed and StateDown is reported on error, the caller reports StateUp by up
+// when the connection is usable.
+func (r *reconnector) connect(ctx context.Context, dial func(ctx context.Context) (net.Conn, error), setup func(ctx context.Context, conn net.Conn) error) (net.Conn, error) {
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+	conn, err := dial(ctx)
+	if err != nil {
+		r.down(err)
+		return nil, err
+	}
+	if setup != nil {
+		if err := setup(ctx, conn); err != nil {
+			conn.Close()
+			err = contextErr(ctx, err)
+			r.down(err)
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// dialTCP returns the dial function of connect to the TCP address.
+func dialTCP(addr *net.TCPAddr) func(ctx context.Context) (net.Conn, error) {
+	return func(ctx context.Context) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", addr.String())
+	}
+}
+
+// up reports StateUp and resets the backoff.
+func (r *reconnector) up() {
+	r.failures = 0
+	r.next = time.Time{}
+	r.set(StateUp, nil)
+}
+
+// down reports StateDown by err and delays the next reconnection.
+func (r *reconnector) down(err error) {
+	r.next = time.Now().Add(r.backoff.delay(r.failures))
+	r.failures++
+	r.set(StateDown, err)
+}
+
+// closed reports StateDown without the delay, the client is closed by the user.
+func (r *reconnector) closed() {
+	r.failures = 0
+	r.next = time.Time{}
+	r.set(StateDown, nil)
+}
+
+func (r *reconnector) set(state ConnState, err error) {
+	if r.state == state {
+		return
+	}
+	r.state = state
+	if r.handler != nil {
+		r.handler(state, err)
+	}
+}
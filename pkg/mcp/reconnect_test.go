@@ -0,0 +1,200 @@
+package mcp
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBackoff_Delay(t *testing.T) {
+	b := Backoff{Min: 100 * time.Millisecond, Max: time.Second, Multiplier: 2}
+	for attempt, expected := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		if actual := b.delay(attempt); actual != expected*time.Millisecond {
+			t.Fatalf("attempt %v: expected %v but actual is %v", attempt, expected*time.Millisecond, actual)
+		}
+	}
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := b.delay(1); d < 100*time.Millisecond || d > 300*time.Millisecond {
+			t.Fatalf("delay %v is out of jitter range", d)
+		}
+	}
+
+	if d := (Backoff{}).delay(3); d != 0 {
+		t.Fatalf("expected no delay but %v", d)
+	}
+}
+
+func TestClient3E_Reconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	// plc closes each connection after one response
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			if _, err := readRequest(conn, false); err == nil {
+				conn.Write([]byte{0xd0, 0x00, 0x00, 0xff, 0xff, 0x03, 0x00, 0x04, 0x00, 0x00, 0x00, 0x01, 0x00})
+			}
+			conn.Close()
+		}
+	}()
+
+	var mu sync.Mutex
+	var states []ConnState
+	handler := func(state ConnState, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		states = append(states, state)
+	}
+	backoff := Backoff{Min: 100 * time.Millisecond, Max: time.Second, Multiplier: 2}
+	addr := ln.Addr().(*net.TCPAddr)
+	client, err := New3EClient(addr.IP.String(), addr.Port, NewLocalStation(), WithBackoff(backoff), WithStateHandler(handler))
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+
+	if _, err := client.Read("D", 0, 1); err != nil {
+		t.Fatalf("unexpected mcp read err: %v", err)
+	}
+	// the connection is closed by plc
+	if _, err := client.Read("D", 0, 1); err == nil {
+		t.Fatalf("expected connection error but nil")
+	}
+	start := time.Now()
+	if _, err := client.Read("D", 0, 1); err != nil {
+		t.Fatalf("unexpected mcp read err: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < backoff.Min {
+		t.Fatalf("reconnected after %v, expected backoff %v", elapsed, backoff.Min)
+	}
+	client.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []ConnState{StateConnecting, StateUp, StateDown, StateConnecting, StateUp, StateDown}
+	if len(states) != len(expected) {
+		t.Fatalf("expected states %v but actual is %v", expected, states)
+	}
+	for i := range expected {
+		if states[i] != expected[i] {
+			t.Fatalf("expected states %v but actual is %v", expected, states)
+		}
+	}
+}
+
+func TestClient_CloseState(t *testing.T) {
+	read3E := "d000 00 ff ff03 00 0400 0000 0100"
+	read3EBinary, _ := hex.DecodeString(strings.ReplaceAll(read3E, " ", ""))
+	// the last empty response keeps the connection open until the client is closed.
+	cases := []struct {
+		name      string
+		newClient func(t *testing.T, opts ...Option) (Client, error)
+	}{
+		{name: "3E", newClient: func(t *testing.T, opts ...Option) (Client, error) {
+			host, port := servePLC(t, read3E, "")
+			return New3EClient(host, port, NewLocalStation(), opts...)
+		}},
+		{name: "4E", newClient: func(t *testing.T, opts ...Option) (Client, error) {
+			host, port := servePLC(t, "d400 0000 0000 00 ff ff03 00 0400 0000 0100", "")
+			return New4EClient(host, port, NewLocalStation(), opts...)
+		}},
+		{name: "1E", newClient: func(t *testing.T, opts ...Option) (Client, error) {
+			host, port := servePLC(t, "81 00 0100", "")
+			return New1EClient(host, port, NewLocalStation(), opts...)
+		}},
+		{name: "UDP", newClient: func(t *testing.T, opts ...Option) (Client, error) {
+			host, port := servePLCUDP(t, func(req []byte) [][]byte { return [][]byte{read3EBinary} })
+			return New3EUDPClient(host, port, NewLocalStation(), opts...)
+		}},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(t *testing.T) {
+			type event struct {
+				state ConnState
+				err   error
+			}
+			var mu sync.Mutex
+			var events []event
+			handler := func(state ConnState, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, event{state: state, err: err})
+			}
+			client, err := v.newClient(t, WithStateHandler(handler))
+			if err != nil {
+				t.Fatalf("unexpected client err: %v", err)
+			}
+			if _, err := client.Read("D", 0, 1); err != nil {
+				t.Fatalf("unexpected mcp read err: %v", err)
+			}
+			if err := client.Close(); err != nil {
+				t.Fatalf("unexpected close err: %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			expected := []event{{state: StateConnecting}, {state: StateUp}, {state: StateDown}}
+			if len(events) != len(expected) {
+				t.Fatalf("expected events %v but actual is %v", expected, events)
+			}
+			for i := range expected {
+				if events[i] != expected[i] {
+					t.Fatalf("expected events %v but actual is %v", expected, events)
+				}
+			}
+		})
+	}
+}
+
+func TestClient3E_BackoffContext(t *testing.T) {
+	// no plc listens on the port, so the connection fails and the next one waits for the backoff
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := ln.Addr().(*net.TCPAddr)
+	ln.Close()
+
+	backoff := Backoff{Min: 500 * time.Millisecond, Max: 500 * time.Millisecond, Multiplier: 1}
+	client, err := New3EClient(addr.IP.String(), addr.Port, NewLocalStation(), WithBackoff(backoff))
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+	if _, err := client.Read("D", 0, 1); err == nil {
+		t.Fatalf("expected connection error but nil")
+	}
+
+	// the first request waits for the backoff holding the connection
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		client.ReadContext(ctx, "D", 0, 1)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// the request queued behind it is given up by its own deadline
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.ReadContext(ctx, "D", 0, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded but actual is %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("request waited %v for the backoff of the other request", elapsed)
+	}
+}
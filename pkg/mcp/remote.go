@@ -0,0 +1,123 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Confirm is the explicit confirmation of remote operation.
+// remote operation changes the state of the CPU, so it is executed only when Confirmed is passed.
+// it can not be made from bool or by the other package, the call must name Confirmed like
+//
+//	client.RemoteStop(mcp.Confirmed)
+type Confirm struct {
+	ok bool
+}
+
+// Confirmed confirms remote operation.
+var Confirmed = Confirm{ok: true}
+
+// ErrNotConfirmed is returned when remote operation is called without confirmation.
+var ErrNotConfirmed = errors.New("remote operation is not confirmed")
+
+// ClearMode is device memory clear mode of remote RUN.
+type ClearMode int
+
+const (
+	// NoClear does not clear the device memory.
+	NoClear ClearMode = iota
+	// ClearExceptLatch clears the device memory out of the latch range.
+	ClearExceptLatch
+	// ClearAll clears all the device memory including the latch range.
+	ClearAll
+)
+
+// RemoteRun is send remote RUN command to remote plc.
+// If force is true, RUN is executed even while other device is doing remote STOP or PAUSE.
+func (c *baseClient) RemoteRun(force bool, clear ClearMode, confirm Confirm) error {
+	return c.RemoteRunContext(context.Background(), force, clear, confirm)
+}
+
+// RemoteRunContext is RemoteRun with the context. the request is canceled when ctx is done.
+func (c *baseClient) RemoteRunContext(ctx context.Context, force bool, clear ClearMode, confirm Confirm) error {
+	return c.remote(ctx, REMOTE_RUN_COMMAND, force, clear, confirm)
+}
+
+// RemoteStop is send remote STOP command to remote plc.
+func (c *baseClient) RemoteStop(confirm Confirm) error {
+	return c.RemoteStopContext(context.Background(), confirm)
+}
+
+// RemoteStopContext is RemoteStop with the context. the request is canceled when ctx is done.
+func (c *baseClient) RemoteStopContext(ctx context.Context, confirm Confirm) error {
+	return c.remote(ctx, REMOTE_STOP_COMMAND, false, NoClear, confirm)
+}
+
+// RemotePause is send remote PAUSE command to remote plc.
+// If force is true, PAUSE is executed even while other device is doing remote PAUSE.
+func (c *baseClient) RemotePause(force bool, confirm Confirm) error {
+	return c.RemotePauseContext(context.Background(), force, confirm)
+}
+
+// RemotePauseContext is RemotePause with the context. the request is canceled when ctx is done.
+func (c *baseClient) RemotePauseContext(ctx context.Context, force bool, confirm Confirm) error {
+	return c.remote(ctx, REMOTE_PAUSE_COMMAND, force, NoClear, confirm)
+}
+
+// RemoteLatchClear is send remote latch clear command to remote plc. the CPU must be in STOP.
+func (c *baseClient) RemoteLatchClear(confirm Confirm) error {
+	return c.RemoteLatchClearContext(context.Background(), confirm)
+}
+
+// RemoteLatchClearContext is RemoteLatchClear with the context. the request is canceled when ctx is done.
+func (c *baseClient) RemoteLatchClearContext(ctx context.Context, confirm Confirm) error {
+	return c.remote(ctx, REMOTE_LATCH_CLEAR_COMMAND, false, NoClear, confirm)
+}
+
+// REMOTE_RESET_TIMEOUT is the limit of RemoteReset to wait for the response.
+const REMOTE_RESET_TIMEOUT = 5 * time.Second
+
+// RemoteReset is send remote RESET command to remote plc. the CPU must be in STOP.
+// the plc may not return the response because the CPU is reset, so the response is waited for
+// REMOTE_RESET_TIMEOUT at most.
+func (c *baseClient) RemoteReset(confirm Confirm) error {
+	ctx, cancel := context.WithTimeout(context.Background(), REMOTE_RESET_TIMEOUT)
+	defer cancel()
+	return c.RemoteResetContext(ctx, confirm)
+}
+
+// RemoteResetContext is RemoteReset with the context. the request is canceled when ctx is done.
+// the request is succeeded when it is sent and the connection is closed or reset, or the deadline of ctx
+// is exceeded before the response, because the CPU may be reset before it returns the response.
+func (c *baseClient) RemoteResetContext(ctx context.Context, confirm Confirm) error {
+	err := c.remote(ctx, REMOTE_RESET_COMMAND, false, NoClear, confirm)
+	if responseLost(err) {
+		return nil
+	}
+	return err
+}
+
+// responseLost reports whether err is the response of the sent request which is lost by the closed or reset
+// connection or the timeout.
+func responseLost(err error) bool {
+	var noResp *noResponseError
+	if !errors.As(err, &noResp) {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errNoResponse) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func (c *baseClient) remote(ctx context.Context, command string, force bool, clear ClearMode, confirm Confirm) error {
+	if !confirm.ok {
+		return ErrNotConfirmed
+	}
+	_, err := c.request(ctx, c.stn.appendRemoteCommand(nil, c.code, command, force, clear), 0, c.code.decodeWords)
+	return err
+}
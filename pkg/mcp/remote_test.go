@@ -0,0 +1,129 @@
+package mcp
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStation_BuildRemoteCommand(t *testing.T) {
+	station := NewLocalStation()
+
+	cases := []struct {
+		actual   string
+		expected string
+	}{
+		{
+			actual:   Binary.string(station.appendRemoteCommand(nil, Binary, REMOTE_RUN_COMMAND, true, ClearExceptLatch)),
+			expected: "01100000" + "0300" + "01" + "00",
+		},
+		{
+			actual:   Ascii.string(station.appendRemoteCommand(nil, Ascii, REMOTE_RUN_COMMAND, false, NoClear)),
+			expected: "10010000" + "0001" + "00" + "00",
+		},
+		{
+			actual:   Binary.string(station.appendRemoteCommand(nil, Binary, REMOTE_STOP_COMMAND, false, NoClear)),
+			expected: "02100000" + "0100",
+		},
+		{
+			actual:   Binary.string(station.appendRemoteCommand(nil, Binary, REMOTE_PAUSE_COMMAND, true, NoClear)),
+			expected: "03100000" + "0300",
+		},
+		{
+			actual:   Ascii.string(station.appendRemoteCommand(nil, Ascii, REMOTE_RESET_COMMAND, false, NoClear)),
+			expected: "10060000" + "0001",
+		},
+	}
+
+	for _, v := range cases {
+		if v.actual != v.expected {
+			t.Errorf("expected %v but actual is %v", v.expected, v.actual)
+		}
+	}
+}
+
+func TestClient3E_Remote(t *testing.T) {
+	host, port := servePLC(t,
+		"d000 00 ff ff03 00 0200 0000",
+	)
+
+	client, err := New3EClient(host, port, NewLocalStation())
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	// not confirmed operation is not sent to the plc
+	if err := client.RemoteStop(Confirm{}); err != ErrNotConfirmed {
+		t.Fatalf("expected %v but actual is %v", ErrNotConfirmed, err)
+	}
+
+	if err := client.RemoteStop(Confirmed); err != nil {
+		t.Fatalf("unexpected remote stop err: %v", err)
+	}
+}
+
+func TestClient3E_RemoteReset(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	// the first plc is reset and closes the connection without the response,
+	// the second plc does not respond until the deadline.
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		readRequest(conn, false)
+		conn.Close()
+
+		conn, err = ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(io.Discard, conn)
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	backoff := Backoff{Min: time.Millisecond, Max: time.Millisecond, Multiplier: 1}
+	client, err := New3EClient(addr.IP.String(), addr.Port, NewLocalStation(), WithBackoff(backoff))
+	if err != nil {
+		t.Fatalf("unexpected client err: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.RemoteReset(Confirmed); err != nil {
+		t.Fatalf("unexpected remote reset err of the closed connection: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.RemoteResetContext(ctx, Confirmed); err != nil {
+		t.Fatalf("unexpected remote reset err of no response: %v", err)
+	}
+
+	// the request which is not sent is failed
+	ln.Close()
+	if err := client.RemoteReset(Confirmed); err == nil {
+		t.Fatalf("expected connection error but nil")
+	}
+}
+
+func ExampleClient_RemoteStop() {
+	client, err := New3EClient("192.168.3.1", 5012, NewLocalStation())
+	if err != nil {
+		return
+	}
+	defer client.Close()
+
+	// remote operation is executed only with Confirmed, client.RemoteStop(true) does not compile.
+	if err := client.RemoteStop(Confirmed); err != nil {
+		return
+	}
+}
@@ -1,21 +1,32 @@
 package mcp
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 )
 
 type parser struct {
+	// data communication code of the response
+	code Code
 }
 
+// NewParser returns binary code response parser.
 func NewParser() *parser {
-	return &parser{}
+	return &parser{code: Binary}
+}
+
+// NewParserWithCode returns response parser of the data communication code.
+func NewParserWithCode(code Code) *parser {
+	return &parser{code: code}
 }
 
 // Response represents mcp response
 type Response struct {
 	// Sub header
 	SubHeader string
+	// Serial number. only 4E frame has it.
+	Serial string
 	// network number
 	NetworkNum string
 	// PC number
@@ -30,32 +41,261 @@ type Response struct {
 	EndCode string
 	// Response data
 	Payload []byte
-	// error data
+	// error information of abnormal end. 3E and 4E error information is binary layout of
+	// network num + PC num + unit I/O num + unit station num + command + sub command, 1E is abnormal code.
 	ErrInfo []byte
 }
 
+// Do parses 1E, 3E or 4E response frame. header fields are represented as binary mode expression
+// regardless of the code, payload is not converted.
+// 1E response has only SubHeader, EndCode, Payload and ErrInfo.
 func (p *parser) Do(resp []byte) (*Response, error) {
+	if is1E(p.code, resp) {
+		return p.do1E(resp)
+	}
+
+	f, err := parseFrame(p.code, resp)
+	if err != nil {
+		return nil, err
+	}
+	subHeader := Binary.string(resp[0:2])
+	if p.code == Ascii {
+		subHeader = string(resp[0:4])
+	}
+	serial := ""
+	if f.is4E {
+		serial = hexUint(int64(f.serial), 2)
+	}
+	return &Response{
+		SubHeader:      subHeader,
+		Serial:         serial,
+		NetworkNum:     hexUint(int64(f.networkNum), 1),
+		PCNum:          hexUint(int64(f.pcNum), 1),
+		UnitIONum:      hexUint(int64(f.unitIONum), 2),
+		UnitStationNum: hexUint(int64(f.unitStationNum), 1),
+		DataLen:        hexUint(int64(f.dataLen), 2),
+		EndCode:        hexUint(int64(f.endCode), 2),
+		Payload:        f.payload,
+		ErrInfo:        f.errInfo,
+	}, nil
+}
+
+// Payload returns the response data of 1E, 3E or 4E response frame. error is returned when end code is not normal.
+// it is the payload of Do without the header fields, so 3E and 4E frame is parsed without allocation.
+func (p *parser) Payload(resp []byte) ([]byte, error) {
+	if is1E(p.code, resp) {
+		response, err := p.do1E(resp)
+		if err != nil {
+			return nil, err
+		}
+		if err := response.Err(); err != nil {
+			return nil, err
+		}
+		return response.Payload, nil
+	}
+
+	f, err := parseFrame(p.code, resp)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.err(); err != nil {
+		return nil, err
+	}
+	return f.payload, nil
+}
+
+// frame is 3E or 4E response frame. the header fields are the values instead of the hex strings of Response.
+type frame struct {
+	// 4E frame has the serial number
+	is4E   bool
+	serial uint16
+	// response header
+	networkNum     uint8
+	pcNum          uint8
+	unitIONum      uint16
+	unitStationNum uint8
+	dataLen        uint16
+	endCode        uint16
+	// response data of normal end. it is not converted from the code.
+	payload []byte
+	// error information of abnormal end in binary layout like Response.ErrInfo.
+	errInfo []byte
+}
+
+// parseFrame parses 3E or 4E response frame of the code without allocation.
+// only ascii error information is converted to binary layout by allocating.
+func parseFrame(code Code, resp []byte) (frame, error) {
+	var f frame
+	if code == Ascii {
+		return f, f.parseAscii(resp)
+	}
+
 	if len(resp) < 11 {
-		return nil, errors.New("length must be larger than 22 byte")
+		return f, errors.New("length must be larger than 22 byte")
+	}
+	if resp[0] == 0xD4 && resp[1] == 0x00 {
+		if len(resp) < 15 {
+			return f, errors.New("4E frame length must be larger than 15 byte")
+		}
+		f.is4E = true
+		f.serial = binary.LittleEndian.Uint16(resp[2:4])
+		resp = resp[4:] // skip serial number and fixed 0000
 	}
+	f.setHeader(resp[2:11])
+	if f.endCode == 0 {
+		f.payload = resp[11:]
+	} else {
+		// payload of abnormal end is error information
+		f.errInfo = resp[11:]
+	}
+	return f, nil
+}
 
-	subHeaderB := resp[0:2]
-	networkNumB := resp[2:3]
-	pcNumB := resp[3:4]
-	unitIONumB := resp[4:6]
-	unitStationNumB := resp[6:7]
-	dataLenB := resp[7:9]
-	endCodeB := resp[9:11]
-	payloadB := resp[11:]
+func (f *frame) parseAscii(resp []byte) error {
+	if len(resp) < 22 {
+		return errors.New("length must be larger than 22 byte")
+	}
+	if string(resp[0:4]) == RESPONSE_SUB_HEADER_4E {
+		if len(resp) < 30 {
+			return errors.New("4E frame length must be larger than 30 byte")
+		}
+		serial, ok := parseHex(resp[4:8])
+		if !ok {
+			return fmt.Errorf("invalid serial number [%s]", resp[4:8])
+		}
+		f.is4E = true
+		f.serial = uint16(serial)
+		resp = resp[8:] // skip serial number and fixed 0000
+	}
 
+	var header [9]byte
+	if _, ok := appendAsciiFields(header[:0], resp[4:22]); !ok {
+		return fmt.Errorf("invalid response header [%s]", resp[4:22])
+	}
+	f.setHeader(header[:])
+	if f.endCode == 0 {
+		f.payload = resp[22:]
+		return nil
+	}
+	// error information is converted to binary layout like the header fields
+	if info := resp[22:]; len(info) >= 18 {
+		f.errInfo, _ = appendAsciiFields(make([]byte, 0, 9), info[0:18])
+	}
+	return nil
+}
+
+// setHeader sets the header fields from binary layout of
+// network num + PC num + unit I/O num + unit station num + data length + end code.
+func (f *frame) setHeader(header []byte) {
+	f.networkNum = header[0]
+	f.pcNum = header[1]
+	f.unitIONum = binary.LittleEndian.Uint16(header[2:4])
+	f.unitStationNum = header[4]
+	f.dataLen = binary.LittleEndian.Uint16(header[5:7])
+	f.endCode = binary.LittleEndian.Uint16(header[7:9])
+}
+
+// appendAsciiFields converts ascii header fields or error information (network num + PC num + unit I/O num +
+// unit station num + 2 words) to binary layout and appends it to dst. ok is false if the field is not hex.
+func appendAsciiFields(dst []byte, fields []byte) ([]byte, bool) {
+	for _, size := range [...]int{2, 2, 4, 2, 4, 4} {
+		v, ok := parseHex(fields[:size])
+		if !ok {
+			return dst, false
+		}
+		dst = Binary.appendUint(dst, int64(v), size/2)
+		fields = fields[size:]
+	}
+	return dst, true
+}
+
+// err returns *EndCodeError if end code of the response is not 0000.
+func (f *frame) err() error {
+	if f.endCode == 0 {
+		return nil
+	}
+	return newEndCodeError(f.endCode, f.errInfo)
+}
+
+// appendBinaryFrame appends binary code response frame of the response header and payload to dst.
+func appendBinaryFrame(dst []byte, f frame, payload []byte) []byte {
+	if f.is4E {
+		dst = append(dst, 0xD4, 0x00, byte(f.serial), byte(f.serial>>8), 0x00, 0x00)
+	} else {
+		dst = append(dst, 0xD0, 0x00)
+	}
+	dst = append(dst, f.networkNum, f.pcNum, byte(f.unitIONum), byte(f.unitIONum>>8), f.unitStationNum)
+	dst = Binary.appendUint(dst, int64(2+len(payload)), 2) // end code + payload
+	dst = Binary.appendUint(dst, int64(f.endCode), 2)
+	return append(dst, payload...)
+}
+
+func (p *parser) do1E(resp []byte) (*Response, error) {
+	f, err := parseFrame1E(p.code, resp)
+	if err != nil {
+		return nil, err
+	}
 	return &Response{
-		SubHeader:      fmt.Sprintf("%X", subHeaderB),
-		NetworkNum:     fmt.Sprintf("%X", networkNumB),
-		PCNum:          fmt.Sprintf("%X", pcNumB),
-		UnitIONum:      fmt.Sprintf("%X", unitIONumB),
-		UnitStationNum: fmt.Sprintf("%X", unitStationNumB),
-		DataLen:        fmt.Sprintf("%X", dataLenB),
-		EndCode:        fmt.Sprintf("%X", endCodeB),
-		Payload:        payloadB,
+		SubHeader: hexUint(int64(f.subHeader), 1),
+		EndCode:   hexUint(int64(f.endCode), 1),
+		Payload:   f.payload,
+		ErrInfo:   f.errInfo,
 	}, nil
 }
+
+// frame1E is 1E response frame. the header fields are the values instead of the hex strings of Response.
+type frame1E struct {
+	subHeader uint8
+	endCode   uint8
+	// response data of normal end. it is not converted from the code.
+	payload []byte
+	// abnormal code of the end code 5B in binary layout like Response.ErrInfo.
+	errInfo []byte
+}
+
+// parseFrame1E parses 1E response frame of the code.
+// only ascii abnormal code is converted to binary layout by allocating.
+func parseFrame1E(code Code, resp []byte) (frame1E, error) {
+	var f frame1E
+	headerSize := int(code.fieldSize(2)) // sub header + end code
+	if len(resp) < headerSize {
+		return f, errors.New("1E frame length must be larger than 2 byte")
+	}
+
+	if code == Ascii {
+		header, ok := parseHex(resp[0:4])
+		if !ok {
+			return f, fmt.Errorf("invalid response header [%s]", resp[0:4])
+		}
+		f.subHeader, f.endCode = uint8(header>>8), uint8(header)
+	} else {
+		f.subHeader, f.endCode = resp[0], resp[1]
+	}
+	f.payload = resp[headerSize:]
+	if f.endCode != END_CODE_ABNORMAL_1E {
+		return f, nil
+	}
+
+	// abnormal code is binary layout like the error information of 3E.
+	f.errInfo, f.payload = f.payload, nil
+	if code == Ascii {
+		info, ok := appendHexBytes(nil, f.errInfo)
+		if !ok {
+			return f, fmt.Errorf("invalid abnormal code [%s]", f.errInfo)
+		}
+		f.errInfo = info
+	}
+	return f, nil
+}
+
+// err returns *EndCodeError if end code of the response is not 00.
+func (f *frame1E) err() error {
+	if f.endCode == 0 {
+		return nil
+	}
+	e := &EndCodeError{EndCode: uint16(f.endCode), is1E: true}
+	if len(f.errInfo) > 0 {
+		e.AbnormalCode = f.errInfo[0]
+	}
+	return e
+}
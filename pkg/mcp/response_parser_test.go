@@ -2,6 +2,7 @@ package mcp
 
 import (
 	"encoding/hex"
+	"errors"
 	"github.com/google/go-cmp/cmp"
 	"testing"
 )
@@ -31,3 +32,58 @@ func TestParser_Do(t *testing.T) {
 		t.Errorf("parse Resp differs: (-got +want)\n%s", diff)
 	}
 }
+
+func TestParser_DoAscii(t *testing.T) {
+	p := NewParserWithCode(Ascii)
+	response, err := p.Do([]byte("D00000FF03FF00000C00001234ABCD"))
+	if err != nil {
+		t.Fatalf("unexpected parser err: %v", err)
+	}
+
+	expected := &Response{
+		SubHeader:      "D000",
+		NetworkNum:     "00",
+		PCNum:          "FF",
+		UnitIONum:      "FF03",
+		UnitStationNum: "00",
+		DataLen:        "0C00",
+		EndCode:        "0000",
+		Payload:        []byte("1234ABCD"),
+		ErrInfo:        nil,
+	}
+
+	if diff := cmp.Diff(response, expected); diff != "" {
+		t.Errorf("parse Resp differs: (-got +want)\n%s", diff)
+	}
+}
+
+func TestParser_Payload(t *testing.T) {
+	payload, err := NewParser().Payload([]byte("\xD4\x00\x34\x12\x00\x00\x00\xFF\xFF\x03\x00\x04\x00\x00\x00\x01\x00"))
+	if err != nil {
+		t.Fatalf("unexpected parser err: %v", err)
+	}
+	if diff := cmp.Diff(payload, []byte{0x01, 0x00}); diff != "" {
+		t.Errorf("payload differs: (-got +want)\n%s", diff)
+	}
+
+	_, err = NewParserWithCode(Ascii).Payload([]byte("D00000FF03FF000016C05100FF03FF0004010000"))
+	var endCodeErr *EndCodeError
+	if !errors.As(err, &endCodeErr) {
+		t.Fatalf("expected end code err but actual is %v", err)
+	}
+	if endCodeErr.EndCode != 0xC051 || endCodeErr.Command != 0x0401 || endCodeErr.UnitIONum != 0x03FF {
+		t.Errorf("unexpected end code err: %+v", endCodeErr)
+	}
+}
+
+func BenchmarkParser_Payload(b *testing.B) {
+	resp, _ := hex.DecodeString("d00000ffff03000a00000001000200030004")
+	p := NewParser()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Payload(resp); err != nil {
+			b.Fatalf("unexpected parser err: %v", err)
+		}
+	}
+}
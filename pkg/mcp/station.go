@@ -1,13 +1,17 @@
 package mcp
 
 import (
-	"bytes"
-	"encoding/binary"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 const (
-	SUB_HEADER = "5000" // 3Eフレームでは固定
+	SUB_HEADER    = "5000" // 3Eフレームでは固定
+	SUB_HEADER_4E = "5400" // 4Eフレームでは固定、後にシリアル番号が続く
+
+	RESPONSE_SUB_HEADER_4E = "D400"
 
 	HEALTH_CHECK_COMMAND    = "1906" // binary mode expression. if ascii mode then 0619
 	HEALTH_CHECK_SUBCOMMAND = "0000"
@@ -16,25 +20,216 @@ const (
 	READ_SUB_COMMAND     = "0000"
 	BIT_READ_SUB_COMMAND = "0100"
 
-	WRITE_COMMAND     = "0114" // binary mode expression. if ascii mode then 1401
-	WRITE_SUB_COMMAND = "0000"
+	WRITE_COMMAND         = "0114" // binary mode expression. if ascii mode then 1401
+	WRITE_SUB_COMMAND     = "0000"
+	BIT_WRITE_SUB_COMMAND = "0100"
+
+	RANDOM_READ_COMMAND  = "0304" // binary mode expression. if ascii mode then 0403
+	RANDOM_WRITE_COMMAND = "0214" // binary mode expression. if ascii mode then 1402
+
+	BLOCK_READ_COMMAND  = "0604" // binary mode expression. if ascii mode then 0406
+	BLOCK_WRITE_COMMAND = "0614" // binary mode expression. if ascii mode then 1406
+
+	MONITOR_REGISTER_COMMAND = "0108" // binary mode expression. if ascii mode then 0801
+	MONITOR_COMMAND          = "0208" // binary mode expression. if ascii mode then 0802
+	MONITOR_SUB_COMMAND      = "0000"
+
+	CPU_MODEL_COMMAND     = "0101" // binary mode expression. if ascii mode then 0101
+	CPU_MODEL_SUB_COMMAND = "0000"
+
+	MEMORY_READ_COMMAND         = "0106" // binary mode expression. if ascii mode then 0601
+	MEMORY_WRITE_COMMAND        = "0116" // binary mode expression. if ascii mode then 1601
+	MODULE_BUFFER_READ_COMMAND  = "1306" // binary mode expression. if ascii mode then 0613
+	MODULE_BUFFER_WRITE_COMMAND = "1316" // binary mode expression. if ascii mode then 1613
+	MEMORY_SUB_COMMAND          = "0000"
+
+	UNLOCK_COMMAND       = "3016" // binary mode expression. if ascii mode then 1630
+	LOCK_COMMAND         = "3116" // binary mode expression. if ascii mode then 1631
+	PASSWORD_SUB_COMMAND = "0000"
+
+	REMOTE_RUN_COMMAND         = "0110" // binary mode expression. if ascii mode then 1001
+	REMOTE_STOP_COMMAND        = "0210" // binary mode expression. if ascii mode then 1002
+	REMOTE_PAUSE_COMMAND       = "0310" // binary mode expression. if ascii mode then 1003
+	REMOTE_LATCH_CLEAR_COMMAND = "0510" // binary mode expression. if ascii mode then 1005
+	REMOTE_RESET_COMMAND       = "0610" // binary mode expression. if ascii mode then 1006
+	REMOTE_SUB_COMMAND         = "0000"
+
+	// MELSEC iQ-R sub command. device number is 4byte and device code is 2byte.
+	IQR_SUB_COMMAND     = "0200"
+	IQR_BIT_SUB_COMMAND = "0300"
 
 	MONITORING_TIMER = "1000" // 3[sec]
 )
 
+// device is device code of the device name.
+type device struct {
+	// binary mode device code
+	code string
+	// device number is hexadecimal notation. (e.g. X, Y, B, W)
+	hex bool
+	// ascii mode device code of MELSEC-Q/L if it is not the device name. (e.g. STN is "SN")
+	ascii string
+	// the device is MELSEC iQ-R only.
+	iqr bool
+}
+
 // deviceCodes is device name and hex value map
-var deviceCodes = map[string]string{
-	"X": "9C",
-	"Y": "9D",
-	"M": "90",
-	"L": "92",
-	"F": "93",
-	"V": "94",
-	"B": "A0",
-	"W": "B4",
-	"D": "A8",
+var deviceCodes = map[string]device{
+	"SM": {code: "91"}, // 特殊リレー
+	"SD": {code: "A9"}, // 特殊レジスタ
+	"X":  {code: "9C", hex: true},
+	"Y":  {code: "9D", hex: true},
+	"M":  {code: "90"},
+	"L":  {code: "92"},
+	"F":  {code: "93"},
+	"V":  {code: "94"},
+	"B":  {code: "A0", hex: true},
+	"D":  {code: "A8"},
+	"W":  {code: "B4", hex: true},
+	"TS": {code: "C1"}, // タイマ 接点
+	"TC": {code: "C0"}, // タイマ コイル
+	"TN": {code: "C2"}, // タイマ 現在値
+	"CS": {code: "C4"}, // カウンタ 接点
+	"CC": {code: "C3"}, // カウンタ コイル
+	"CN": {code: "C5"}, // カウンタ 現在値
+	"SB": {code: "A1", hex: true},
+	"SW": {code: "B5", hex: true},
+	"DX": {code: "A2", hex: true},
+	"DY": {code: "A3", hex: true},
+	"S":  {code: "98"}, // ステップリレー
+	"Z":  {code: "CC"},
+	"R":  {code: "AF"},
+	"ZR": {code: "B0"},
+
+	// 積算タイマ. ascii device code of MELSEC-Q/L is 2 char.
+	"STS": {code: "C7", ascii: "SS"},
+	"STC": {code: "C6", ascii: "SC"},
+	"STN": {code: "C8", ascii: "SN"},
+
+	// MELSEC iQ-R only
+	"LTN":  {code: "52", iqr: true},
+	"LTS":  {code: "51", iqr: true},
+	"LTC":  {code: "50", iqr: true},
+	"LSTN": {code: "5A", iqr: true},
+	"LSTS": {code: "59", iqr: true},
+	"LSTC": {code: "58", iqr: true},
+	"LCN":  {code: "56", iqr: true},
+	"LCS":  {code: "55", iqr: true},
+	"LCC":  {code: "54", iqr: true},
+	"LZ":   {code: "62", iqr: true},
+	"RD":   {code: "2C", iqr: true},
+}
+
+// DeviceAddr is a device of the PLC like D100.
+type DeviceAddr struct {
+	// device code name like 'D' register.
+	DeviceName string
+	// device offset addr.
+	Offset int64
+}
+
+// String returns device address like "D100", "X1F".
+func (d DeviceAddr) String() string {
+	if IsHexDevice(d.DeviceName) {
+		return fmt.Sprintf("%s%X", d.DeviceName, d.Offset)
+	}
+	return fmt.Sprintf("%s%d", d.DeviceName, d.Offset)
+}
+
+// ParseDeviceAddr parses device address like "D100", "X1F" or "W1A0".
+// device number is hexadecimal or decimal by the notation of the device.
+func ParseDeviceAddr(s string) (DeviceAddr, error) {
+	// the longest device name is matched first, "SB1" is SB not S.
+	name := ""
+	for n := range deviceCodes {
+		if strings.HasPrefix(s, n) && len(n) > len(name) {
+			name = n
+		}
+	}
+	if name == "" {
+		return DeviceAddr{}, fmt.Errorf("unknown device of address %q", s)
+	}
+
+	base := 10
+	if deviceCodes[name].hex {
+		base = 16
+	}
+	offset, err := strconv.ParseInt(s[len(name):], base, 64)
+	if err != nil {
+		return DeviceAddr{}, fmt.Errorf("invalid device number of address %q: %w", s, err)
+	}
+	return DeviceAddr{DeviceName: name, Offset: offset}, nil
+}
+
+// IsHexDevice reports whether the device number of the device is hexadecimal notation like X1F.
+func IsHexDevice(deviceName string) bool {
+	return deviceCodes[deviceName].hex
+}
+
+// lookupDevice returns device code of the device name for the series.
+func lookupDevice(deviceName string, series Series) (device, error) {
+	dev, ok := deviceCodes[deviceName]
+	if !ok {
+		return device{}, fmt.Errorf("unknown device %s", deviceName)
+	}
+	if dev.iqr && series != IQRSeries {
+		return device{}, fmt.Errorf("device %s is supported only by MELSEC iQ-R", deviceName)
+	}
+	return dev, nil
+}
+
+// checkDevices checks all the devices are supported by the station series.
+func (h *station) checkDevices(addrs ...DeviceAddr) error {
+	for _, addr := range addrs {
+		if _, err := lookupDevice(addr.DeviceName, h.series); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkBlocks checks the devices of all the blocks are supported by the station series.
+func (h *station) checkBlocks(blocks []Block) error {
+	for _, b := range blocks {
+		if err := h.checkDevices(b.DeviceAddr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Block is contiguous device points of multiple block batch read and write.
+type Block struct {
+	DeviceAddr
+	// number of points to read. bit device block is read in word units, 1 point is 16 bits.
+	Points int64
+	// data to write. number of points to write is len(Data), Points is ignored on write.
+	Data []uint16
 }
 
+// sortDeviceAddrs sorts devices by device name and offset.
+func sortDeviceAddrs(addrs []DeviceAddr) {
+	sort.Slice(addrs, func(i, j int) bool {
+		if addrs[i].DeviceName != addrs[j].DeviceName {
+			return addrs[i].DeviceName < addrs[j].DeviceName
+		}
+		return addrs[i].Offset < addrs[j].Offset
+	})
+}
+
+// PLC series. This item is operating device addressing of the request.
+type Series int
+
+const (
+	// QLSeries is MELSEC-Q/L series addressing.
+	// device number is 3byte and device code is 1byte (ascii 6 char and 2 char).
+	QLSeries Series = iota
+
+	// IQRSeries is MELSEC iQ-R series extended addressing.
+	// device number is 4byte and device code is 2byte (ascii 10 char and 4 char).
+	IQRSeries
+)
+
 // Each single PLC that is connected on MELSECNET and CC-Link IE is called a station.
 type station struct {
 	// PLC Network number
@@ -45,6 +240,8 @@ type station struct {
 	unitIONum string
 	// PLC stn Unit Station Number
 	unitStationNum string
+	// PLC series. default is QLSeries.
+	series Series
 }
 
 func NewStation(networkNum, pcNum, unitIONum, unitStationNum string) *station {
@@ -56,6 +253,21 @@ func NewStation(networkNum, pcNum, unitIONum, unitStationNum string) *station {
 	}
 }
 
+// SetSeries sets PLC series of the station and returns the station.
+func (h *station) SetSeries(series Series) *station {
+	h.series = series
+	return h
+}
+
+// SetRoute sets access route to the other station on the network and returns the station.
+func (h *station) SetRoute(route AccessRoute) *station {
+	h.networkNum = hexUint(int64(route.NetworkNum), 1)
+	h.pcNum = hexUint(int64(route.StationNum), 1)
+	h.unitIONum = hexUint(int64(route.ModuleIO), 2)
+	h.unitStationNum = hexUint(int64(route.MultidropStation), 1)
+	return h
+}
+
 // local stn stn. local stn is 自局.
 func NewLocalStation() *station {
 	return &station{
@@ -67,26 +279,7 @@ func NewLocalStation() *station {
 }
 
 func (h *station) BuildHealthCheckRequest() string {
-
-	returnDataNum := "0500"    // 5 device. if ascii mode then 0005
-	returnData := "4142434445" // value is "ABCDE".
-
-	requestStr := HEALTH_CHECK_COMMAND + HEALTH_CHECK_SUBCOMMAND + returnDataNum + returnData
-
-	// data length
-	requestCharLen := len(MONITORING_TIMER+requestStr) / 2 // 1byte=2char
-	dataLenBuff := new(bytes.Buffer)
-	_ = binary.Write(dataLenBuff, binary.LittleEndian, int64(requestCharLen))
-	dataLen := fmt.Sprintf("%X", dataLenBuff.Bytes()[0:2]) // 2byte固定
-
-	return SUB_HEADER +
-		h.networkNum +
-		h.pcNum +
-		h.unitIONum +
-		h.unitStationNum +
-		dataLen +
-		MONITORING_TIMER +
-		requestStr
+	return Binary.string(h.appendFrame3E(nil, Binary, h.appendHealthCheckCommand(nil, Binary)))
 }
 
 // BuildReadRequest represents MCP read as word command.
@@ -94,79 +287,15 @@ func (h *station) BuildHealthCheckRequest() string {
 // offset is device offset addr.
 // numPoints is number of read device points.
 func (h *station) BuildReadRequest(deviceName string, offset, numPoints int64) string {
+	return Binary.string(h.appendFrame3E(nil, Binary, h.appendReadCommand(nil, Binary, deviceName, offset, numPoints)))
+}
 
-	// get device symbol hex layout
-	deviceCode := deviceCodes[deviceName]
-
-	// offset convert to little endian layout
-	// MELSECコミュニケーションプロトコル リファレンス(p67) MELSEC-Q/L: 3[byte], MELSEC iQ-R: 4[byte]
-	offsetBuff := new(bytes.Buffer)
-	_ = binary.Write(offsetBuff, binary.LittleEndian, offset)
-	offsetHex := fmt.Sprintf("%X", offsetBuff.Bytes()[0:3]) // 仮にQシリーズとするので3byte trim
-
-	// read points
-	pointsBuff := new(bytes.Buffer)
-	_ = binary.Write(pointsBuff, binary.LittleEndian, numPoints)
-	points := fmt.Sprintf("%X", pointsBuff.Bytes()[0:2]) // 2byte固定
-
-	// data length
-	requestCharLen := len(MONITORING_TIMER+READ_COMMAND+READ_SUB_COMMAND+deviceCode+offsetHex+points) / 2 // 1byte=2char
-	dataLenBuff := new(bytes.Buffer)
-	_ = binary.Write(dataLenBuff, binary.LittleEndian, int64(requestCharLen))
-	dataLen := fmt.Sprintf("%X", dataLenBuff.Bytes()[0:2]) // 2byte固定
-
-	return SUB_HEADER +
-		h.networkNum +
-		h.pcNum +
-		h.unitIONum +
-		h.unitStationNum +
-		dataLen +
-		MONITORING_TIMER +
-		READ_COMMAND +
-		READ_SUB_COMMAND +
-		offsetHex +
-		deviceCode +
-		points
-}
-
-// BuildReadRequest represents MCP read as bit command.
-// deviceName is device code name like 'D' register.
+// BuildBitReadRequest represents MCP read as bit command.
+// deviceName is device code name like 'M' relay.
 // offset is device offset addr.
 // numPoints is number of read device points.
 func (h *station) BuildBitReadRequest(deviceName string, offset, numPoints int64) string {
-
-	// get device symbol hex layout
-	deviceCode := deviceCodes[deviceName]
-
-	// offset convert to little endian layout
-	// MELSECコミュニケーションプロトコル リファレンス(p67) MELSEC-Q/L: 3[byte], MELSEC iQ-R: 4[byte]
-	offsetBuff := new(bytes.Buffer)
-	_ = binary.Write(offsetBuff, binary.LittleEndian, offset)
-	offsetHex := fmt.Sprintf("%X", offsetBuff.Bytes()[0:3]) // 仮にQシリーズとするので3byte trim
-
-	// read points
-	pointsBuff := new(bytes.Buffer)
-	_ = binary.Write(pointsBuff, binary.LittleEndian, numPoints)
-	points := fmt.Sprintf("%X", pointsBuff.Bytes()[0:2]) // 2byte固定
-
-	// data length
-	requestCharLen := len(MONITORING_TIMER+READ_COMMAND+BIT_READ_SUB_COMMAND+deviceCode+offsetHex+points) / 2 // 1byte=2char
-	dataLenBuff := new(bytes.Buffer)
-	_ = binary.Write(dataLenBuff, binary.LittleEndian, int64(requestCharLen))
-	dataLen := fmt.Sprintf("%X", dataLenBuff.Bytes()[0:2]) // 2byte固定
-
-	return SUB_HEADER +
-		h.networkNum +
-		h.pcNum +
-		h.unitIONum +
-		h.unitStationNum +
-		dataLen +
-		MONITORING_TIMER +
-		READ_COMMAND +
-		BIT_READ_SUB_COMMAND +
-		offsetHex +
-		deviceCode +
-		points
+	return Binary.string(h.appendFrame3E(nil, Binary, h.appendBitReadCommand(nil, Binary, deviceName, offset, numPoints)))
 }
 
 // BuildWriteRequest represents MCP write command.
@@ -175,48 +304,328 @@ func (h *station) BuildBitReadRequest(deviceName string, offset, numPoints int64
 // writeData is data to write.
 // numPoints is number of write device points.
 // writeData is the data to be written. If writeData is larger than 2*numPoints bytes,
-// data larger than 2*numPoints bytes is ignored.
+// data larger than 2*numPoints bytes is ignored. If it is smaller, the rest is written as 0.
 func (h *station) BuildWriteRequest(deviceName string, offset, numPoints int64, writeData []byte) string {
+	return Binary.string(h.appendFrame3E(nil, Binary, h.appendWriteCommand(nil, Binary, deviceName, offset, numPoints, writeData)))
+}
+
+// append*Command appends the command part of the request (command + sub command + request data)
+// to dst in the code expression and returns the extended buffer like append.
+// it is common to all frames, frame header is added by appendFrame3E or appendFrame4E.
+// the command is built without allocation when dst has enough capacity.
+
+func (h *station) appendHealthCheckCommand(dst []byte, code Code) []byte {
+	dst = appendCommand(dst, code, HEALTH_CHECK_COMMAND, HEALTH_CHECK_SUBCOMMAND)
+	dst = code.appendUint(dst, 5, 2) // 5 device.
+
+	// value is "ABCDE", 折り返しデータ is same on both code.
+	return append(dst, "ABCDE"...)
+}
+
+func (h *station) appendReadCommand(dst []byte, code Code, deviceName string, offset, numPoints int64) []byte {
+	dst = appendCommand(dst, code, READ_COMMAND, h.subCommand(READ_SUB_COMMAND))
+	dst = h.appendDevice(dst, code, deviceName, offset)
+	return code.appendUint(dst, numPoints, 2) // points is 2byte固定
+}
+
+func (h *station) appendBitReadCommand(dst []byte, code Code, deviceName string, offset, numPoints int64) []byte {
+	dst = appendCommand(dst, code, READ_COMMAND, h.subCommand(BIT_READ_SUB_COMMAND))
+	dst = h.appendDevice(dst, code, deviceName, offset)
+	return code.appendUint(dst, numPoints, 2)
+}
+
+func (h *station) appendWriteCommand(dst []byte, code Code, deviceName string, offset, numPoints int64, writeData []byte) []byte {
+	dst = appendCommand(dst, code, WRITE_COMMAND, h.subCommand(WRITE_SUB_COMMAND))
+	dst = h.appendDevice(dst, code, deviceName, offset)
+	dst = code.appendUint(dst, numPoints, 2)
+
+	// 2 byte per 1 device point. the data over the points is ignored and the rest is written as 0.
+	if int64(len(writeData)) > 2*numPoints {
+		writeData = writeData[:2*numPoints]
+	}
+	dst = code.appendWords(dst, writeData[:len(writeData)&^1])
+	written := int64(len(writeData) / 2)
+	if len(writeData)%2 == 1 {
+		dst = code.appendUint(dst, int64(writeData[len(writeData)-1]), 2)
+		written++
+	}
+	for ; written < numPoints; written++ {
+		dst = code.appendUint(dst, 0, 2)
+	}
+	return dst
+}
+
+// appendRandomReadCommand represents MCP random read command of word and double word devices.
+func (h *station) appendRandomReadCommand(dst []byte, code Code, words, dwords []DeviceAddr) []byte {
+	dst = appendCommand(dst, code, RANDOM_READ_COMMAND, h.subCommand(READ_SUB_COMMAND))
+	return h.appendDevices(dst, code, words, dwords)
+}
+
+// appendMonitorRegisterCommand represents MCP monitor registration command.
+// request data is same as random read.
+func (h *station) appendMonitorRegisterCommand(dst []byte, code Code, words, dwords []DeviceAddr) []byte {
+	dst = appendCommand(dst, code, MONITOR_REGISTER_COMMAND, h.subCommand(READ_SUB_COMMAND))
+	return h.appendDevices(dst, code, words, dwords)
+}
+
+// appendDevices appends number of word and double word devices and the devices of random read.
+func (h *station) appendDevices(dst []byte, code Code, words, dwords []DeviceAddr) []byte {
+	dst = code.appendUint(dst, int64(len(words)), 1)
+	dst = code.appendUint(dst, int64(len(dwords)), 1)
+	for _, d := range words {
+		dst = h.appendDevice(dst, code, d.DeviceName, d.Offset)
+	}
+	for _, d := range dwords {
+		dst = h.appendDevice(dst, code, d.DeviceName, d.Offset)
+	}
+	return dst
+}
+
+// appendMonitorCommand represents MCP monitor command of the registered devices.
+func (h *station) appendMonitorCommand(dst []byte, code Code) []byte {
+	return appendCommand(dst, code, MONITOR_COMMAND, MONITOR_SUB_COMMAND)
+}
+
+// appendCPUModelCommand represents MCP read CPU model name command.
+func (h *station) appendCPUModelCommand(dst []byte, code Code) []byte {
+	return appendCommand(dst, code, CPU_MODEL_COMMAND, CPU_MODEL_SUB_COMMAND)
+}
+
+// appendMemoryCommand represents MCP memory read or write command of the own station module buffer memory.
+// address and numPoints are word units. data is little endian words to write, it is empty on read.
+func (h *station) appendMemoryCommand(dst []byte, code Code, command string, address, numPoints int64, data []byte) []byte {
+	dst = appendCommand(dst, code, command, MEMORY_SUB_COMMAND)
+	dst = code.appendUint(dst, address, 4)
+	dst = code.appendUint(dst, numPoints, 2)
+	return code.appendWords(dst, data)
+}
+
+// appendModuleBufferCommand represents MCP intelligent function module buffer memory read or write command.
+// address and numBytes are byte units. module is upper digits of the module start I/O number (start I/O / 16).
+// data is little endian words to write, it is empty on read.
+func (h *station) appendModuleBufferCommand(dst []byte, code Code, command string, module uint16, address, numBytes int64, data []byte) []byte {
+	dst = appendCommand(dst, code, command, MEMORY_SUB_COMMAND)
+	dst = code.appendUint(dst, address, 4)
+	dst = code.appendUint(dst, numBytes, 2)
+	dst = code.appendUint(dst, int64(module), 2)
+	return code.appendWords(dst, data)
+}
+
+// appendPasswordCommand represents MCP remote password unlock or lock command.
+// password is sent as ascii characters on both code.
+func (h *station) appendPasswordCommand(dst []byte, code Code, command, password string) []byte {
+	dst = appendCommand(dst, code, command, PASSWORD_SUB_COMMAND)
+	dst = code.appendUint(dst, int64(len(password)), 2)
+	return append(dst, password...)
+}
+
+// appendRemoteCommand represents MCP remote operation command.
+// remote run is mode[2byte] + clear mode[1byte] + 00, remote pause is mode[2byte], others are 0001 fixed.
+func (h *station) appendRemoteCommand(dst []byte, code Code, command string, force bool, clear ClearMode) []byte {
+	mode := int64(0x0001) // 強制実行しない
+	if force {
+		mode = 0x0003 // 強制実行する
+	}
+
+	dst = appendCommand(dst, code, command, REMOTE_SUB_COMMAND)
+	switch command {
+	case REMOTE_RUN_COMMAND:
+		dst = code.appendUint(dst, mode, 2)
+		dst = code.appendUint(dst, int64(clear), 1)
+		return code.appendUint(dst, 0, 1)
+	case REMOTE_PAUSE_COMMAND:
+		return code.appendUint(dst, mode, 2)
+	default:
+		return code.appendUint(dst, 0x0001, 2)
+	}
+}
+
+// appendRandomWriteCommand represents MCP random write command of word and double word devices.
+func (h *station) appendRandomWriteCommand(dst []byte, code Code, words []DeviceAddr, wordValues []uint16, dwords []DeviceAddr, dwordValues []uint32) []byte {
+	dst = appendCommand(dst, code, RANDOM_WRITE_COMMAND, h.subCommand(WRITE_SUB_COMMAND))
+	dst = code.appendUint(dst, int64(len(words)), 1)
+	dst = code.appendUint(dst, int64(len(dwords)), 1)
+	for i, d := range words {
+		dst = h.appendDevice(dst, code, d.DeviceName, d.Offset)
+		dst = code.appendUint(dst, int64(wordValues[i]), 2)
+	}
+	for i, d := range dwords {
+		dst = h.appendDevice(dst, code, d.DeviceName, d.Offset)
+		dst = code.appendUint(dst, int64(dwordValues[i]), 4)
+	}
+	return dst
+}
+
+// appendRandomBitWriteCommand represents MCP random write command of bit devices.
+// ON/OFF is 1byte, MELSEC iQ-R is 2byte.
+func (h *station) appendRandomBitWriteCommand(dst []byte, code Code, bits []DeviceAddr, values []bool) []byte {
+	valueSize := 1
+	if h.series == IQRSeries {
+		valueSize = 2
+	}
+
+	dst = appendCommand(dst, code, RANDOM_WRITE_COMMAND, h.subCommand(BIT_WRITE_SUB_COMMAND))
+	dst = code.appendUint(dst, int64(len(bits)), 1)
+	for i, d := range bits {
+		var value int64
+		if values[i] {
+			value = 1
+		}
+		dst = h.appendDevice(dst, code, d.DeviceName, d.Offset)
+		dst = code.appendUint(dst, value, valueSize)
+	}
+	return dst
+}
+
+// appendBlockReadCommand represents MCP multiple block batch read command.
+func (h *station) appendBlockReadCommand(dst []byte, code Code, words, bits []Block) []byte {
+	dst = appendCommand(dst, code, BLOCK_READ_COMMAND, h.subCommand(READ_SUB_COMMAND))
+	dst = code.appendUint(dst, int64(len(words)), 1)
+	dst = code.appendUint(dst, int64(len(bits)), 1)
+	for _, blocks := range [2][]Block{words, bits} {
+		for _, b := range blocks {
+			dst = h.appendDevice(dst, code, b.DeviceName, b.Offset)
+			dst = code.appendUint(dst, b.Points, 2)
+		}
+	}
+	return dst
+}
+
+// appendBlockWriteCommand represents MCP multiple block batch write command.
+func (h *station) appendBlockWriteCommand(dst []byte, code Code, words, bits []Block) []byte {
+	dst = appendCommand(dst, code, BLOCK_WRITE_COMMAND, h.subCommand(WRITE_SUB_COMMAND))
+	dst = code.appendUint(dst, int64(len(words)), 1)
+	dst = code.appendUint(dst, int64(len(bits)), 1)
+	for _, blocks := range [2][]Block{words, bits} {
+		for _, b := range blocks {
+			dst = h.appendDevice(dst, code, b.DeviceName, b.Offset)
+			dst = code.appendUint(dst, int64(len(b.Data)), 2)
+			for _, v := range b.Data {
+				dst = code.appendUint(dst, int64(v), 2)
+			}
+		}
+	}
+	return dst
+}
 
+// appendDevice appends device code and device number part of the request.
+func (h *station) appendDevice(dst []byte, code Code, deviceName string, offset int64) []byte {
 	// get device symbol hex layout
-	deviceCode := deviceCodes[deviceName]
+	dev := deviceCodes[deviceName]
 
-	// offset convert to little endian layout
 	// MELSECコミュニケーションプロトコル リファレンス(p67) MELSEC-Q/L: 3[byte], MELSEC iQ-R: 4[byte]
-	offsetBuff := new(bytes.Buffer)
-	_ = binary.Write(offsetBuff, binary.LittleEndian, offset)
-	offsetHex := fmt.Sprintf("%X", offsetBuff.Bytes()[0:3]) // 仮にQシリーズとするので3byte trim
-
-	// convert write data to little endian word
-	writeBuff := new(bytes.Buffer)
-	_ = binary.Write(writeBuff, binary.LittleEndian, writeData)
-	writeHex := fmt.Sprintf("%X", writeBuff.Bytes()[0:2*numPoints]) // 2 byte per 1 device point
-
-	// write points
-	pointsBuff := new(bytes.Buffer)
-	_ = binary.Write(pointsBuff, binary.LittleEndian, numPoints)
-	points := fmt.Sprintf("%X", pointsBuff.Bytes()[0:2]) // 2byte固定
-
-	// data length
-	requestCharLen := len(MONITORING_TIMER+WRITE_COMMAND+WRITE_SUB_COMMAND+deviceCode+offsetHex+points+writeHex) / 2 // 1byte=2char
-	dataLenBuff := new(bytes.Buffer)
-	_ = binary.Write(dataLenBuff, binary.LittleEndian, int64(requestCharLen))
-	dataLen := fmt.Sprintf("%X", dataLenBuff.Bytes()[0:2]) // 2byte固定
-	return SUB_HEADER +
-		h.networkNum +
-		h.pcNum +
-		h.unitIONum +
-		h.unitStationNum +
-		dataLen +
-		MONITORING_TIMER +
-		WRITE_COMMAND +
-		WRITE_SUB_COMMAND +
-		offsetHex +
-		deviceCode +
-		points +
-		writeHex
-}
-
-func (h *station) BuildAccessPath() {
+	numberSize, codeSize, asciiNumberSize := 3, 1, 6
+	if h.series == IQRSeries {
+		numberSize, codeSize, asciiNumberSize = 4, 2, 10
+	}
+
+	if code == Ascii {
+		// ascii device code is padded with '*' like "D*" (iQ-R "D***").
+		name := deviceName
+		if dev.ascii != "" && h.series != IQRSeries {
+			name = dev.ascii
+		}
+		dst = append(dst, name...)
+		for i := len(name); i < 2*codeSize; i++ {
+			dst = append(dst, '*')
+		}
+		if dev.hex {
+			return appendDigits(dst, offset, asciiNumberSize, 16)
+		}
+		return appendDigits(dst, offset, asciiNumberSize, 10)
+	}
+
+	// offset convert to little endian layout
+	dst = code.appendUint(dst, offset, numberSize)
+	dst = code.appendHex(dst, dev.code)
+	for i := 1; i < codeSize; i++ {
+		dst = append(dst, 0x00)
+	}
+	return dst
+}
+
+// appendDigits appends v as upper case digits of the base padded with 0 to width like "%0*X" or "%0*d".
+func appendDigits(dst []byte, v int64, width int, base uint64) []byte {
+	u := uint64(v)
+	n := 1
+	for x := u / base; x > 0; x /= base {
+		n++
+	}
+	for ; width > n; width-- {
+		dst = append(dst, '0')
+	}
+	start := len(dst)
+	for i := 0; i < n; i++ {
+		dst = append(dst, '0')
+	}
+	for i := len(dst) - 1; i >= start; i-- {
+		dst[i] = hexDigits[u%base]
+		u /= base
+	}
+	return dst
+}
+
+// subCommand returns sub command of device access for the station series.
+// MELSEC-Q/L sub command is returned as it is.
+func (h *station) subCommand(subCommand string) string {
+	if h.series != IQRSeries {
+		return subCommand
+	}
+	if subCommand == BIT_READ_SUB_COMMAND || subCommand == BIT_WRITE_SUB_COMMAND {
+		return IQR_BIT_SUB_COMMAND
+	}
+	return IQR_SUB_COMMAND
+}
+
+// appendCommand appends command and sub command. command and subCommand are binary mode expression.
+func appendCommand(dst []byte, code Code, command, subCommand string) []byte {
+	dst = code.appendHex(dst, command)
+	return code.appendHex(dst, subCommand)
+}
+
+// appendFrame3E appends 3E request frame of the command to dst.
+func (h *station) appendFrame3E(dst []byte, code Code, command []byte) []byte {
+	dst = appendSubHeader(dst, code, SUB_HEADER)
+	return h.appendHeader(dst, code, command)
+}
+
+// appendFrame4E appends 4E request frame of the command with the serial number to dst.
+// response of the request has the same serial number.
+func (h *station) appendFrame4E(dst []byte, code Code, serial uint16, command []byte) []byte {
+	dst = appendSubHeader(dst, code, SUB_HEADER_4E)
+	dst = code.appendUint(dst, int64(serial), 2)
+	dst = code.appendUint(dst, 0, 2)
+	return h.appendHeader(dst, code, command)
+}
+
+// appendSubHeader appends the sub header. it is same order on both code, ascii is not swapped.
+func appendSubHeader(dst []byte, code Code, subHeader string) []byte {
+	if code == Ascii {
+		return append(dst, subHeader...)
+	}
+	return Binary.appendHex(dst, subHeader)
+}
+
+// appendHeader appends common part of 3E and 4E frame after sub header and the command.
+func (h *station) appendHeader(dst []byte, code Code, command []byte) []byte {
+	dst = h.appendAccessPath(dst, code)
+
+	// data length is monitoring timer + command, 2byte固定
+	dst = code.appendUint(dst, code.fieldSize(2)+int64(len(command)), 2)
+	dst = code.appendHex(dst, MONITORING_TIMER)
+	return append(dst, command...)
+}
+
+// BuildAccessPath returns network number, PC number, request destination module I/O number
+// and request destination module station number of the request header.
+func (h *station) BuildAccessPath(code Code) string {
+	return code.string(h.appendAccessPath(nil, code))
+}
 
+// appendAccessPath appends the access path of BuildAccessPath to dst.
+func (h *station) appendAccessPath(dst []byte, code Code) []byte {
+	dst = code.appendHex(dst, h.networkNum)
+	dst = code.appendHex(dst, h.pcNum)
+	dst = code.appendHex(dst, h.unitIONum)
+	return code.appendHex(dst, h.unitStationNum)
 }
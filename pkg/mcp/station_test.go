@@ -15,3 +15,235 @@ func TestStation_BuildRRequest(t *testing.T) {
 		t.Fatalf("expected %v but actual is %v", "500000FFFF03000C00100001040000F40100A83200", request2)
 	}
 }
+
+func TestStation_BuildRequestAscii(t *testing.T) {
+	station := NewLocalStation()
+
+	cases := []struct {
+		actual   string
+		expected string
+	}{
+		{
+			actual:   Ascii.string(station.appendFrame3E(nil, Ascii, station.appendReadCommand(nil, Ascii, "D", 300, 3))),
+			expected: "500000FF03FF000018001004010000D*0003000003",
+		},
+		{
+			actual:   Ascii.string(station.appendFrame3E(nil, Ascii, station.appendBitReadCommand(nil, Ascii, "X", 0x1F, 2))),
+			expected: "500000FF03FF000018001004010001X*00001F0002",
+		},
+		{
+			actual:   Ascii.string(station.appendFrame3E(nil, Ascii, station.appendWriteCommand(nil, Ascii, "D", 100, 2, []byte{0x34, 0x12, 0xCD, 0xAB}))),
+			expected: "500000FF03FF000020001014010000D*00010000021234ABCD",
+		},
+		{
+			actual:   Ascii.string(station.appendFrame3E(nil, Ascii, station.appendHealthCheckCommand(nil, Ascii))),
+			expected: "500000FF03FF000015001006190000" + "0005ABCDE",
+		},
+	}
+
+	for _, v := range cases {
+		if v.actual != v.expected {
+			t.Errorf("expected %v but actual is %v", v.expected, v.actual)
+		}
+	}
+}
+
+func TestStation_Frame4E(t *testing.T) {
+	station := NewLocalStation()
+
+	request := Binary.string(station.appendFrame4E(nil, Binary, 0x1234, station.appendReadCommand(nil, Binary, "D", 300, 3)))
+	if request != "540034120000"+"00FFFF03000C001000010400002C0100A80300" {
+		t.Fatalf("expected %v but actual is %v", "54003412000000FFFF03000C001000010400002C0100A80300", request)
+	}
+
+	request2 := Ascii.string(station.appendFrame4E(nil, Ascii, 0x1234, station.appendReadCommand(nil, Ascii, "D", 300, 3)))
+	if request2 != "540012340000"+"00FF03FF000018001004010000D*0003000003" {
+		t.Fatalf("expected %v but actual is %v", "54001234000000FF03FF000018001004010000D*0003000003", request2)
+	}
+}
+
+func TestStation_BuildRequestIQR(t *testing.T) {
+	station := NewLocalStation().SetSeries(IQRSeries)
+
+	cases := []struct {
+		actual   string
+		expected string
+	}{
+		{
+			actual:   station.BuildReadRequest("D", 300, 3),
+			expected: "500000FFFF03000E001000010402002C010000A8000300",
+		},
+		{
+			actual:   station.BuildBitReadRequest("LZ", 0x1000000, 1),
+			expected: "500000FFFF03000E001000010403000000000162000100",
+		},
+		{
+			actual:   Ascii.string(station.appendFrame3E(nil, Ascii, station.appendReadCommand(nil, Ascii, "W", 0x1A0, 1))),
+			expected: "500000FF03FF00001E001004010002W***00000001A00001",
+		},
+	}
+
+	for _, v := range cases {
+		if v.actual != v.expected {
+			t.Errorf("expected %v but actual is %v", v.expected, v.actual)
+		}
+	}
+}
+
+func TestStation_BuildRandomReadCommand(t *testing.T) {
+	station := NewLocalStation()
+
+	words := []DeviceAddr{{DeviceName: "D", Offset: 300}, {DeviceName: "M", Offset: 16}}
+	dwords := []DeviceAddr{{DeviceName: "D", Offset: 400}}
+
+	command := Binary.string(station.appendRandomReadCommand(nil, Binary, words, dwords))
+	if command != "03040000"+"0201"+"2C0100A8"+"10000090"+"900100A8" {
+		t.Fatalf("expected %v but actual is %v", "0304000002012C0100A810000090900100A8", command)
+	}
+
+	command2 := Ascii.string(station.appendRandomReadCommand(nil, Ascii, words, dwords))
+	if command2 != "04030000"+"0201"+"D*000300"+"M*000016"+"D*000400" {
+		t.Fatalf("expected %v but actual is %v", "040300000201D*000300M*000016D*000400", command2)
+	}
+}
+
+func TestStation_BuildRandomWriteCommand(t *testing.T) {
+	station := NewLocalStation()
+
+	command := Binary.string(station.appendRandomWriteCommand(nil, Binary,
+		[]DeviceAddr{{DeviceName: "D", Offset: 300}}, []uint16{0x1234},
+		[]DeviceAddr{{DeviceName: "D", Offset: 400}}, []uint32{0x12345678}))
+	if command != "02140000"+"0101"+"2C0100A8"+"3412"+"900100A8"+"78563412" {
+		t.Fatalf("expected %v but actual is %v", "0214000001012C0100A83412900100A878563412", command)
+	}
+
+	command2 := Ascii.string(station.appendRandomBitWriteCommand(nil, Ascii,
+		[]DeviceAddr{{DeviceName: "M", Offset: 24}, {DeviceName: "Y", Offset: 0x2F}}, []bool{true, false}))
+	if command2 != "14020001"+"02"+"M*000024"+"01"+"Y*00002F"+"00" {
+		t.Fatalf("expected %v but actual is %v", "1402000102M*00002401Y*00002F00", command2)
+	}
+
+	command3 := Binary.string(NewLocalStation().SetSeries(IQRSeries).appendRandomBitWriteCommand(nil, Binary,
+		[]DeviceAddr{{DeviceName: "M", Offset: 24}}, []bool{true}))
+	if command3 != "02140300"+"01"+"180000009000"+"0100" {
+		t.Fatalf("expected %v but actual is %v", "02140300011800000090000100", command3)
+	}
+}
+
+func TestStation_BuildBlockCommand(t *testing.T) {
+	station := NewLocalStation()
+
+	command := Binary.string(station.appendBlockReadCommand(nil, Binary,
+		[]Block{{DeviceAddr: DeviceAddr{DeviceName: "D", Offset: 0}, Points: 25}},
+		[]Block{{DeviceAddr: DeviceAddr{DeviceName: "M", Offset: 16}, Points: 2}}))
+	if command != "06040000"+"0101"+"000000A8"+"1900"+"10000090"+"0200" {
+		t.Fatalf("expected %v but actual is %v", "060400000101000000A8190010000090"+"0200", command)
+	}
+
+	command2 := Ascii.string(station.appendBlockWriteCommand(nil, Ascii,
+		[]Block{{DeviceAddr: DeviceAddr{DeviceName: "D", Offset: 608}, Data: []uint16{0x1234, 0x5678}}},
+		nil))
+	if command2 != "14060000"+"0100"+"D*000608"+"0002"+"1234"+"5678" {
+		t.Fatalf("expected %v but actual is %v", "140600000100D*000608000212345678", command2)
+	}
+}
+
+func TestParseDeviceAddr(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected DeviceAddr
+	}{
+		{input: "D100", expected: DeviceAddr{DeviceName: "D", Offset: 100}},
+		{input: "X1F", expected: DeviceAddr{DeviceName: "X", Offset: 0x1F}},
+		{input: "W1A0", expected: DeviceAddr{DeviceName: "W", Offset: 0x1A0}},
+		{input: "SB10", expected: DeviceAddr{DeviceName: "SB", Offset: 0x10}},
+		{input: "SD10", expected: DeviceAddr{DeviceName: "SD", Offset: 10}},
+		{input: "ZR100000", expected: DeviceAddr{DeviceName: "ZR", Offset: 100000}},
+		{input: "LSTN2", expected: DeviceAddr{DeviceName: "LSTN", Offset: 2}},
+	}
+	for _, v := range cases {
+		actual, err := ParseDeviceAddr(v.input)
+		if err != nil {
+			t.Fatalf("unexpected err of %q: %v", v.input, err)
+		}
+		if actual != v.expected {
+			t.Errorf("expected %v but actual is %v", v.expected, actual)
+		}
+		if actual.String() != v.input {
+			t.Errorf("expected %v but actual is %v", v.input, actual.String())
+		}
+	}
+
+	for _, input := range []string{"Q100", "D1F", "X", ""} {
+		if _, err := ParseDeviceAddr(input); err == nil {
+			t.Errorf("expected err of %q but actual is nil", input)
+		}
+	}
+}
+
+func TestStation_BuildDevice(t *testing.T) {
+	station := NewLocalStation()
+
+	cases := []struct {
+		actual   string
+		expected string
+	}{
+		{actual: Binary.string(station.appendDevice(nil, Binary, "SD", 10)), expected: "0A0000A9"},
+		{actual: Binary.string(station.appendDevice(nil, Binary, "DX", 0x1F)), expected: "1F0000A2"},
+		{actual: Binary.string(station.appendDevice(nil, Binary, "ZR", 100000)), expected: "A08601B0"},
+		{actual: Ascii.string(station.appendDevice(nil, Ascii, "STN", 5)), expected: "SN000005"},
+		{actual: Ascii.string(station.appendDevice(nil, Ascii, "SW", 0x1A0)), expected: "SW0001A0"},
+		{actual: Ascii.string(NewLocalStation().SetSeries(IQRSeries).appendDevice(nil, Ascii, "STN", 5)), expected: "STN*0000000005"},
+	}
+
+	for _, v := range cases {
+		if v.actual != v.expected {
+			t.Errorf("expected %v but actual is %v", v.expected, v.actual)
+		}
+	}
+
+	if err := station.checkDevices(DeviceAddr{DeviceName: "Q", Offset: 0}); err == nil {
+		t.Errorf("expected unknown device err but actual is nil")
+	}
+	if err := station.checkDevices(DeviceAddr{DeviceName: "LZ", Offset: 0}); err == nil {
+		t.Errorf("expected iQ-R only device err but actual is nil")
+	}
+	if err := NewLocalStation().SetSeries(IQRSeries).checkDevices(DeviceAddr{DeviceName: "LZ", Offset: 0}); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+}
+
+func TestStation_AppendFrameAllocs(t *testing.T) {
+	cases := []struct {
+		station *station
+		code    Code
+	}{
+		{station: NewLocalStation(), code: Binary},
+		{station: NewLocalStation(), code: Ascii},
+		{station: NewLocalStation().SetSeries(IQRSeries), code: Ascii},
+	}
+
+	command := make([]byte, 0, 64)
+	frame := make([]byte, 0, 128)
+	for _, v := range cases {
+		allocs := testing.AllocsPerRun(100, func() {
+			command = v.station.appendReadCommand(command[:0], v.code, "W", 0x1A0, 10)
+			frame = v.station.appendFrame4E(frame[:0], v.code, 0x1234, command)
+		})
+		if allocs != 0 {
+			t.Errorf("expected no allocation but %v allocations per frame", allocs)
+		}
+	}
+}
+
+func BenchmarkStation_AppendReadCommand(b *testing.B) {
+	station := NewLocalStation()
+	command := make([]byte, 0, 64)
+	frame := make([]byte, 0, 128)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		command = station.appendReadCommand(command[:0], Binary, "D", int64(i%1000), 10)
+		frame = station.appendFrame3E(frame[:0], Binary, command)
+	}
+}
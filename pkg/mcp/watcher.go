@@ -0,0 +1,153 @@
+package mcp
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// aLongTimeAgo is the deadline which interrupts the blocking I/O immediately.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// deadliner is the connection which deadline is set by the watcher. e.g. net.Conn
+type deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// deadlineKind is the deadline of the connection which the watcher sets.
+type deadlineKind int
+
+const (
+	readWriteDeadline deadlineKind = iota
+	// writeDeadline is the write deadline of net.Conn which is read by the other goroutine at the same time.
+	writeDeadline
+	// readDeadline is the read deadline of net.Conn.
+	readDeadline
+)
+
+// watcher sets the deadline of the request context to the connection and interrupts the blocking I/O
+// when the context is canceled. one goroutine of the watcher is shared by the requests of the transport,
+// so no goroutine is started per request. it watches one request at a time and is guarded by the mutex of the transport.
+// the goroutine is started by the first cancelable context and stopped by close.
+type watcher struct {
+	// connection and deadline of the request being watched
+	conn deadliner
+	kind deadlineKind
+	// ctx is canceled before stop
+	watching bool
+	// channels to the goroutine, nil if it is not started
+	requests chan context.Context
+	stopped  chan struct{}
+	quit     chan struct{}
+}
+
+// watch is start with the deadline of ctx.
+func (w *watcher) watch(ctx context.Context, conn deadliner, kind deadlineKind) {
+	deadline, _ := ctx.Deadline()
+	w.start(ctx, conn, kind, deadline)
+}
+
+// start sets the deadline to conn and interrupts the I/O of conn when ctx is canceled before stop.
+// stop must be called after the I/O.
+func (w *watcher) start(ctx context.Context, conn deadliner, kind deadlineKind, deadline time.Time) {
+	w.conn = conn
+	w.kind = kind
+	w.setDeadline(deadline)
+	if ctx.Done() == nil {
+		return
+	}
+	if w.quit == nil {
+		w.requests = make(chan context.Context)
+		w.stopped = make(chan struct{})
+		w.quit = make(chan struct{})
+		go w.run(w.requests, w.stopped, w.quit)
+	}
+	w.watching = true
+	w.requests <- ctx
+}
+
+// stop stops watching the request and clears the deadline. the I/O is never interrupted after stop returns.
+func (w *watcher) stop() {
+	if w.watching {
+		w.stopped <- struct{}{}
+		w.watching = false
+	}
+	w.setDeadline(time.Time{})
+	w.conn = nil
+}
+
+// close stops the goroutine. the watcher can be used again after close.
+func (w *watcher) close() {
+	if w.quit != nil {
+		close(w.quit)
+		w.requests, w.stopped, w.quit = nil, nil, nil
+	}
+}
+
+// run interrupts the I/O when ctx of the request is canceled, and then waits for stop.
+// conn and kind of the watcher are not changed until stop is received.
+func (w *watcher) run(requests <-chan context.Context, stopped <-chan struct{}, quit <-chan struct{}) {
+	for {
+		select {
+		case ctx := <-requests:
+			select {
+			case <-ctx.Done():
+				w.setDeadline(aLongTimeAgo)
+				<-stopped
+			case <-stopped:
+			}
+		case <-quit:
+			return
+		}
+	}
+}
+
+func (w *watcher) setDeadline(t time.Time) {
+	switch w.kind {
+	case writeDeadline:
+		w.conn.(interface{ SetWriteDeadline(time.Time) error }).SetWriteDeadline(t)
+	case readDeadline:
+		w.conn.(interface{ SetReadDeadline(time.Time) error }).SetReadDeadline(t)
+	default:
+		w.conn.SetDeadline(t)
+	}
+}
+
+// ctxMutex is the mutex of the transport which waiter gives up when the request context is done.
+// the transport is locked during the reconnection backoff and the I/O of the request,
+// so the requests waiting for the lock must honor their context. the zero value is unlocked.
+type ctxMutex struct {
+	once sync.Once
+	// semaphore of one slot, the mutex is locked while it is full
+	ch chan struct{}
+}
+
+func (m *ctxMutex) init() {
+	m.once.Do(func() { m.ch = make(chan struct{}, 1) })
+}
+
+// Lock locks m like sync.Mutex.
+func (m *ctxMutex) Lock() {
+	m.init()
+	m.ch <- struct{}{}
+}
+
+// lockContext locks m, ctx error is returned without the lock when ctx is done before m is unlocked.
+func (m *ctxMutex) lockContext(ctx context.Context) error {
+	m.init()
+	// ctx may be done already, select chooses randomly if m is unlocked too
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case m.ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Unlock unlocks m. it may be unlocked by the other goroutine like sync.Mutex.
+func (m *ctxMutex) Unlock() {
+	<-m.ch
+}
@@ -1,47 +1,479 @@
 package plc
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"nk2-PLCcapture-go/pkg/mcp"
+	"nk2-PLCcapture-go/pkg/utils"
 )
 
 type mspClient struct {
 	client mcp.Client
+	// Mutex to synchronize access to routes
+	mu sync.Mutex
+	// clients of the access routes of the devices. key is the route like "1:2".
+	routes map[string]mcp.Client
+}
+
+// clientFor returns the client of the access route of the device. empty route is Config.Route.
+// the clients of the routes share the connection of the PLC.
+func (m *mspClient) clientFor(route string) (mcp.Client, error) {
+	if route == "" {
+		return m.client, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if client, ok := m.routes[route]; ok {
+		return client, nil
+	}
+	r, err := mcp.ParseAccessRoute(route)
+	if err != nil {
+		return nil, err
+	}
+	client, err := m.client.Route(r)
+	if err != nil {
+		return nil, fmt.Errorf("access route %s: %w", route, err)
+	}
+	if m.routes == nil {
+		m.routes = map[string]mcp.Client{}
+	}
+	m.routes[route] = client
+	return client, nil
+}
+
+// routeGroup is the devices of the same access route and their indexes in the device list.
+type routeGroup struct {
+	route   string
+	indexes []int
+	devices []utils.Device
+}
+
+// groupByRoute groups the devices by the access route in order of the first device of the route.
+func groupByRoute(devices []utils.Device) []*routeGroup {
+	var groups []*routeGroup
+	byRoute := map[string]*routeGroup{}
+	for i, device := range devices {
+		group, ok := byRoute[device.Route]
+		if !ok {
+			group = &routeGroup{route: device.Route}
+			byRoute[device.Route] = group
+			groups = append(groups, group)
+		}
+		group.indexes = append(group.indexes, i)
+		group.devices = append(group.devices, device)
+	}
+	return groups
 }
 
 var msp *mspClient
 
+// Config is the connection setting of the PLC.
+type Config struct {
+	Host string
+	Port int
+	// Ports are the open connection ports of the PLC ethernet module like 5011, 5012.
+	// when it is set, the requests are spread over the connection pool of the ports instead of Port.
+	// only 3E frame over tcp is supported.
+	Ports []int
+	// ConnsPerPort is number of the pooled connections to each of Ports. default is 1.
+	ConnsPerPort int
+	// Frame is MC protocol frame of the PLC ethernet module, "3E" (default), "4E" or "1E".
+	Frame string
+	// Transport is "tcp" (default) or "udp" that is configured on the PLC ethernet module port.
+	Transport string
+	// Series is PLC series for device addressing, "Q" (default, also L series), "iQ-R" or
+	// "auto" that is detected by the CPU model.
+	Series string
+	// Route is access route to the PLC over the network of the connected ethernet module,
+	// network:station[:moduleIO[:multidrop]] like "1:2". empty is the connected PLC.
+	Route string
+	// Password is remote password of the PLC ethernet module. it is unlocked on connect and reconnect.
+	Password string
+	// ReconnectMin and ReconnectMax are the range of the exponential backoff of the reconnection
+	// after the connection is lost. zero is the default of mcp.DefaultBackoff.
+	ReconnectMin time.Duration
+	ReconnectMax time.Duration
+	// StateHandler is called when the connection state to the PLC is changed, e.g. to publish the status.
+	StateHandler mcp.StateHandler
+	// Timeout is the limit of the series detection of "auto". zero is no limit.
+	Timeout time.Duration
+}
+
 func InitMSPClient(plcHost string, plcPort int) error {
+	return InitMSPClientWithConfig(Config{Host: plcHost, Port: plcPort})
+}
+
+// InitMSPClientWithConfig initializes the MSP client with the frame and options of cfg.
+func InitMSPClientWithConfig(cfg Config) error {
 	if msp != nil {
 		return nil
 	}
+	route, err := mcp.ParseAccessRoute(cfg.Route)
+	if err != nil {
+		return err
+	}
+	stn := mcp.NewLocalStation().SetRoute(route)
+	switch cfg.Series {
+	case "", "Q", "L", "auto":
+	case "iQ-R":
+		stn.SetSeries(mcp.IQRSeries)
+	default:
+		return fmt.Errorf("unknown PLC series: %s", cfg.Series)
+	}
+
+	var opts []mcp.Option
+	if cfg.Password != "" {
+		opts = append(opts, mcp.WithPassword(cfg.Password))
+	}
+	backoff := mcp.DefaultBackoff
+	if cfg.ReconnectMin > 0 {
+		backoff.Min = cfg.ReconnectMin
+	}
+	if cfg.ReconnectMax > 0 {
+		backoff.Max = cfg.ReconnectMax
+	}
+	opts = append(opts, mcp.WithBackoff(backoff))
+	if cfg.StateHandler != nil {
+		opts = append(opts, mcp.WithStateHandler(cfg.StateHandler))
+	}
+
 	// Connect to the PLC with MC protocol
-	client, err := mcp.New3EClient(plcHost, plcPort, mcp.NewLocalStation())
+	var client mcp.Client
+	switch cfg.Transport {
+	case "", "tcp", "udp":
+	default:
+		return fmt.Errorf("unknown transport: %s", cfg.Transport)
+	}
+	udp := cfg.Transport == "udp"
+	if len(cfg.Ports) > 0 && (udp || (cfg.Frame != "" && cfg.Frame != "3E")) {
+		return fmt.Errorf("connection pool is supported by 3E frame over tcp only")
+	}
+	switch cfg.Frame {
+	case "", "3E":
+		if len(cfg.Ports) > 0 {
+			connsPerPort := cfg.ConnsPerPort
+			if connsPerPort == 0 {
+				connsPerPort = 1
+			}
+			client, err = mcp.New3EPool(cfg.Host, cfg.Ports, connsPerPort, stn, opts...)
+		} else if udp {
+			client, err = mcp.New3EUDPClient(cfg.Host, cfg.Port, stn, opts...)
+		} else {
+			client, err = mcp.New3EClient(cfg.Host, cfg.Port, stn, opts...)
+		}
+	case "4E":
+		if udp {
+			client, err = mcp.New4EUDPClient(cfg.Host, cfg.Port, stn, opts...)
+		} else {
+			client, err = mcp.New4EClient(cfg.Host, cfg.Port, stn, opts...)
+		}
+	case "1E":
+		if udp {
+			return fmt.Errorf("udp transport is not supported by 1E frame")
+		}
+		client, err = mcp.New1EClient(cfg.Host, cfg.Port, stn, opts...)
+	default:
+		return fmt.Errorf("unknown MC protocol frame: %s", cfg.Frame)
+	}
 	if err != nil {
 		return err
 	}
+
+	if cfg.Series == "auto" {
+		ctx := context.Background()
+		if cfg.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+			defer cancel()
+		}
+		model, err := client.ReadCPUModelContext(ctx)
+		if err != nil {
+			client.Close()
+			return fmt.Errorf("failed to detect PLC series: %w", err)
+		}
+		stn.SetSeries(model.Series())
+	}
+
 	msp = &mspClient{client: client}
 	return nil
 }
 
+// ReadCPUModel reads the model name and model code of the PLC CPU.
+func ReadCPUModel() (mcp.CPUModel, error) {
+	return ReadCPUModelContext(context.Background())
+}
+
+// ReadCPUModelContext is ReadCPUModel with the context. the PLC I/O is canceled when ctx is done.
+func ReadCPUModelContext(ctx context.Context) (mcp.CPUModel, error) {
+	if msp == nil {
+		return mcp.CPUModel{}, fmt.Errorf("MSP client not initialized")
+	}
+	return msp.client.ReadCPUModelContext(ctx)
+}
+
 // ReadData reads data from the PLC for the specified device.
+// deviceType "Un\G" reads the buffer memory of the intelligent function module at start I/O n0 (e.g. "U2\G" is 0020).
 func ReadData(deviceType string, deviceNumber uint16, numberRegisters uint16) (interface{}, error) {
+	return ReadDataContext(context.Background(), deviceType, deviceNumber, numberRegisters)
+}
+
+// ReadDataContext is ReadData with the context. the PLC I/O is canceled when ctx is done.
+func ReadDataContext(ctx context.Context, deviceType string, deviceNumber uint16, numberRegisters uint16) (interface{}, error) {
 	if msp == nil {
 		return nil, fmt.Errorf("MSP client not initialized")
 	}
+	return readData(ctx, msp.client, utils.Device{DeviceType: deviceType, DeviceNumber: deviceNumber, NumberRegisters: numberRegisters})
+}
+
+// readData reads the device with client.
+func readData(ctx context.Context, client mcp.Client, device utils.Device) (interface{}, error) {
+	if startIO, ok := moduleBuffer(device.DeviceType); ok {
+		return readModuleBuffer(ctx, client, startIO, device)
+	}
 	// Read data from the PLC
-	data, err := msp.client.Read(deviceType, int64(deviceNumber), int64(numberRegisters))
+	data, err := client.ReadContext(ctx, device.DeviceType, int64(device.DeviceNumber), int64(device.NumberRegisters))
+	if err != nil {
+		return nil, err
+	}
+	payload, err := mcp.NewParser().Payload(data)
+	if err != nil {
+		return nil, err
+	}
+	return parseValue(device.NumberRegisters, payload)
+}
+
+// ReadDataRandom reads data from the PLC for all the devices with random read command.
+// values are returned in the same order as devices. the devices of each access route are read by a random read
+// and the access routes are read concurrently.
+// If random read is not supported by the PLC frame, each device is read by ReadData.
+func ReadDataRandom(devices []utils.Device) ([]interface{}, error) {
+	return ReadDataRandomContext(context.Background(), devices)
+}
+
+// ReadDataRandomContext is ReadDataRandom with the context. the PLC I/O is canceled when ctx is done.
+func ReadDataRandomContext(ctx context.Context, devices []utils.Device) ([]interface{}, error) {
+	if msp == nil {
+		return nil, fmt.Errorf("MSP client not initialized")
+	}
+
+	groups := groupByRoute(devices)
+	if len(groups) == 1 {
+		client, err := msp.clientFor(groups[0].route)
+		if err != nil {
+			return nil, err
+		}
+		return readDataRandom(ctx, client, devices)
+	}
+
+	// the routes are read concurrently, so the requests are pipelined by 4E frame and spread over the connection pool
+	values := make([]interface{}, len(devices))
+	errs := make([]error, len(groups))
+	var wg sync.WaitGroup
+	for i, group := range groups {
+		wg.Add(1)
+		go func(i int, group *routeGroup) {
+			defer wg.Done()
+			client, err := msp.clientFor(group.route)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			groupValues, err := readDataRandom(ctx, client, group.devices)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			for j, index := range group.indexes {
+				values[index] = groupValues[j]
+			}
+		}(i, group)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// readDataRandom reads the devices with random read command of client.
+func readDataRandom(ctx context.Context, client mcp.Client, devices []utils.Device) ([]interface{}, error) {
+	words, dwords := deviceAddrs(devices)
+	wordValues, dwordValues, err := client.ReadRandomContext(ctx, words, dwords)
+	if errors.Is(err, mcp.ErrUnsupported) {
+		values := make([]interface{}, len(devices))
+		for i, device := range devices {
+			values[i], err = readData(ctx, client, device)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return deviceValues(ctx, client, devices, wordValues, dwordValues)
+}
+
+// Monitor reads the devices registered once to the PLC with monitor registration command.
+// Each ReadData sends only a small monitor command.
+type Monitor struct {
+	devices []utils.Device
+	monitor *mcp.Monitor
+	// client of the access route of the devices
+	client mcp.Client
+}
+
+// NewMonitor registers the devices to the PLC.
+func NewMonitor(devices []utils.Device) (*Monitor, error) {
+	return NewMonitorContext(context.Background(), devices)
+}
+
+// NewMonitorContext is NewMonitor with the context. the PLC I/O is canceled when ctx is done.
+// the devices must be of one access route, the registration is kept per connection.
+func NewMonitorContext(ctx context.Context, devices []utils.Device) (*Monitor, error) {
+	if msp == nil {
+		return nil, fmt.Errorf("MSP client not initialized")
+	}
+
+	route := ""
+	for _, device := range devices {
+		if device.Route != devices[0].Route {
+			return nil, fmt.Errorf("monitor can not register the devices of several access routes")
+		}
+		route = device.Route
+	}
+	client, err := msp.clientFor(route)
 	if err != nil {
 		return nil, err
 	}
 
+	// module buffer memory can not be registered, it is read on each ReadData.
+	words, dwords := deviceAddrs(devices)
+	if len(words)+len(dwords) == 0 {
+		return &Monitor{devices: devices, client: client}, nil
+	}
+	monitor, err := client.RegisterMonitorContext(ctx, words, dwords)
+	if err != nil {
+		return nil, err
+	}
+	return &Monitor{devices: devices, monitor: monitor, client: client}, nil
+}
+
+// ReadData reads data of the registered devices. values are returned in the same order as devices.
+func (m *Monitor) ReadData() ([]interface{}, error) {
+	return m.ReadDataContext(context.Background())
+}
+
+// ReadDataContext is ReadData with the context. the PLC I/O is canceled when ctx is done.
+func (m *Monitor) ReadDataContext(ctx context.Context) ([]interface{}, error) {
+	var wordValues map[mcp.DeviceAddr]uint16
+	var dwordValues map[mcp.DeviceAddr]uint32
+	if m.monitor != nil {
+		var err error
+		wordValues, dwordValues, err = m.monitor.ExecuteContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return deviceValues(ctx, m.client, m.devices, wordValues, dwordValues)
+}
+
+// moduleBuffer returns the module start I/O number of the buffer memory device type "Un\G".
+// n is upper digits of the start I/O number in hex, so "U2\G" is the module of 0020.
+func moduleBuffer(deviceType string) (uint16, bool) {
+	if !strings.HasPrefix(deviceType, "U") || !strings.HasSuffix(deviceType, `\G`) {
+		return 0, false
+	}
+	module, err := strconv.ParseUint(deviceType[1:len(deviceType)-2], 16, 12)
+	if err != nil {
+		return 0, false
+	}
+	return uint16(module) << 4, true
+}
+
+// readModuleBuffer reads the buffer memory word address DeviceNumber of the module at startIO.
+func readModuleBuffer(ctx context.Context, client mcp.Client, startIO uint16, device utils.Device) (interface{}, error) {
+	numPoints := int64(1)
+	if device.NumberRegisters == 2 {
+		numPoints = 2
+	}
+	words, err := client.ReadModuleBufferContext(ctx, startIO, int64(device.DeviceNumber), numPoints)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 2*len(words))
+	for i, w := range words {
+		binary.LittleEndian.PutUint16(data[2*i:], w)
+	}
+	return parseValue(device.NumberRegisters, data)
+}
+
+// deviceAddrs splits the devices into word devices and double word devices.
+// 16-bit and 2-bit devices are read as word, 32-bit devices are read as double word.
+// module buffer memory devices are not included.
+func deviceAddrs(devices []utils.Device) ([]mcp.DeviceAddr, []mcp.DeviceAddr) {
+	var words, dwords []mcp.DeviceAddr
+	for _, device := range devices {
+		if _, ok := moduleBuffer(device.DeviceType); ok {
+			continue
+		}
+		addr := mcp.DeviceAddr{DeviceName: device.DeviceType, Offset: int64(device.DeviceNumber)}
+		if device.NumberRegisters == 2 {
+			dwords = append(dwords, addr)
+		} else {
+			words = append(words, addr)
+		}
+	}
+	return words, dwords
+}
+
+// deviceValues parses the word and double word values of each device.
+// module buffer memory devices are read here.
+func deviceValues(ctx context.Context, client mcp.Client, devices []utils.Device, wordValues map[mcp.DeviceAddr]uint16, dwordValues map[mcp.DeviceAddr]uint32) ([]interface{}, error) {
+	values := make([]interface{}, len(devices))
+	for i, device := range devices {
+		if startIO, ok := moduleBuffer(device.DeviceType); ok {
+			value, err := readModuleBuffer(ctx, client, startIO, device)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+			continue
+		}
+		addr := mcp.DeviceAddr{DeviceName: device.DeviceType, Offset: int64(device.DeviceNumber)}
+		data := make([]byte, 4)
+		if device.NumberRegisters == 2 {
+			binary.LittleEndian.PutUint32(data, dwordValues[addr])
+		} else {
+			binary.LittleEndian.PutUint16(data, wordValues[addr])
+			data = data[:2]
+		}
+		value, err := parseValue(device.NumberRegisters, data)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// parseValue parses the little endian data read from the device.
+func parseValue(numberRegisters uint16, data []byte) (interface{}, error) {
 	var value interface{}
 	if numberRegisters == 1 { // 16-bit device
 		// Parse 16-bit data
-		registerBinary, _ := mcp.NewParser().Do(data)
-		data = registerBinary.Payload
 		var val uint16
 		for i := 0; i < len(data); i++ {
 			val |= uint16(data[i]) << uint(8*i)
@@ -50,8 +482,6 @@ func ReadData(deviceType string, deviceNumber uint16, numberRegisters uint16) (i
 	} else if numberRegisters == 2 { // 32-bit device
 		// Parse 32-bit data
 		var val uint32
-		registerBinary, _ := mcp.NewParser().Do(data)
-		data = registerBinary.Payload
 		for i := 0; i < len(data); i++ {
 			val |= uint32(data[i]) << uint(8*i)
 		}
@@ -72,8 +502,6 @@ func ReadData(deviceType string, deviceNumber uint16, numberRegisters uint16) (i
 		value = firstSixDigits
 	} else if numberRegisters == 3 { // 2-bit device
 		// Parse 2-bit data
-		registerBinary, _ := mcp.NewParser().Do(data)
-		data = registerBinary.Payload
 		var val uint8
 		if len(data) >= 1 {
 			// Extract the 2-bit value from the 8-bit data
@@ -0,0 +1,56 @@
+package plc
+
+import (
+	"testing"
+
+	"nk2-PLCcapture-go/pkg/mcp/mcptest"
+	"nk2-PLCcapture-go/pkg/utils"
+)
+
+// initPLC starts the plc and initializes the MSP client connected to it.
+func initPLC(t *testing.T) *mcptest.Server {
+	t.Helper()
+	plc, err := mcptest.NewServer()
+	if err != nil {
+		t.Fatalf("failed to start plc: %v", err)
+	}
+	t.Cleanup(func() { plc.Close() })
+
+	msp = nil
+	if err := InitMSPClient(plc.Host(), plc.Port()); err != nil {
+		t.Fatalf("unexpected init err: %v", err)
+	}
+	t.Cleanup(func() {
+		msp.client.Close()
+		msp = nil
+	})
+	return plc
+}
+
+func TestReadDataRandom_Routes(t *testing.T) {
+	plc := initPLC(t)
+	plc.SetWords("D", 100, 1, 2, 3)
+
+	// the simulator answers every station, so the devices of the routes are read from the same memory
+	devices := []utils.Device{
+		{DeviceType: "D", DeviceNumber: 100, NumberRegisters: 1},
+		{DeviceType: "D", DeviceNumber: 101, NumberRegisters: 1, Route: "1:2"},
+		{DeviceType: "D", DeviceNumber: 102, NumberRegisters: 1},
+	}
+	values, err := ReadDataRandom(devices)
+	if err != nil {
+		t.Fatalf("unexpected read err: %v", err)
+	}
+	for i, expected := range []uint16{1, 2, 3} {
+		if values[i] != expected {
+			t.Errorf("expected %v but actual is %v", expected, values[i])
+		}
+	}
+	if len(msp.routes) != 1 || msp.routes["1:2"] == nil {
+		t.Errorf("expected the client of route 1:2 but %v", msp.routes)
+	}
+
+	if _, err := NewMonitor(devices); err == nil {
+		t.Errorf("expected monitor error of several routes but nil")
+	}
+}
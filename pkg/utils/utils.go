@@ -4,6 +4,8 @@ import (
 	"log"
 	"strconv"
 	"strings"
+
+	"nk2-PLCcapture-go/pkg/mcp"
 )
 
 // Define the device struct with the address field
@@ -11,6 +13,14 @@ type Device struct {
 	DeviceType      string
 	DeviceNumber    uint16
 	NumberRegisters uint16
+	// Route is the access route to the PLC of the other station like "1:2". empty is the PLC of PLC_ROUTE.
+	Route string
+}
+
+// Address returns the device address in the notation of the device type like "D100" or "X1F".
+// it is the same as the address of the DEVICES environment variable, e.g. "X,1F" is "X1F".
+func (d Device) Address() string {
+	return mcp.DeviceAddr{DeviceName: d.DeviceType, Offset: int64(d.DeviceNumber)}.String()
 }
 
 // ParseDeviceAddresses parses the device addresses from the environment variable.
@@ -21,7 +31,21 @@ func ParseDeviceAddresses(envVar string, logger *log.Logger) ([]Device, error) {
 	}
 	var devices []Device
 	for i := 0; i < len(deviceStrings); i += 3 {
-		deviceNumber, err := strconv.ParseUint(deviceStrings[i+1], 10, 16)
+		// device type may be prefixed by the access route to the PLC of the other station like "1:2@D"
+		deviceType := deviceStrings[i]
+		route := ""
+		if at := strings.LastIndex(deviceType, "@"); at >= 0 {
+			route, deviceType = deviceType[:at], deviceType[at+1:]
+			if _, err := mcp.ParseAccessRoute(route); err != nil {
+				logger.Fatalf("Error parsing device route: %v", err)
+			}
+		}
+		// device number of X, Y, B, W, SB, SW, DX and DY is hexadecimal like "1F"
+		base := 10
+		if mcp.IsHexDevice(deviceType) {
+			base = 16
+		}
+		deviceNumber, err := strconv.ParseUint(deviceStrings[i+1], base, 16)
 		if err != nil {
 			logger.Fatalf("Error parsing device number: %v", err)
 		}
@@ -30,9 +54,10 @@ func ParseDeviceAddresses(envVar string, logger *log.Logger) ([]Device, error) {
 			logger.Fatalf("Error parsing number of registers: %v", err)
 		}
 		devices = append(devices, Device{
-			DeviceType:      deviceStrings[i],
+			DeviceType:      deviceType,
 			DeviceNumber:    uint16(deviceNumber),
 			NumberRegisters: uint16(numberRegisters),
+			Route:           route,
 		})
 	}
 	if len(devices) == 0 {